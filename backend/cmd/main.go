@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"hermes/database"
+	"hermes/helpers"
 	"hermes/routes"
 
 	"github.com/gin-gonic/gin"
@@ -20,6 +21,7 @@ func main() {
 	routes.RegisterRoutes(router)
 
 	database.ConnectDB()
+	helpers.ConnectNotificationBus()
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8081"
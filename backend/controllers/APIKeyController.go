@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"hermes/database"
+	"hermes/helpers"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const apiKeyPrefix = "hms_"
+
+// rejectAPIKeyAuth stops a key from being used to mint or revoke other keys.
+func rejectAPIKeyAuth(c *gin.Context) bool {
+	if _, ok := c.Get("apiKey"); ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API keys cannot manage API keys"})
+		return true
+	}
+	return false
+}
+
+func GetAPIKeys(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	if rejectAPIKeyAuth(c) {
+		return
+	}
+
+	keys, err := database.GetAPIKeysForUser(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve API keys"})
+		return
+	}
+	if keys == nil {
+		keys = []database.APIKey{}
+	}
+	c.JSON(http.StatusOK, gin.H{"keys": keys, "scopes": database.APIKeyScopes})
+}
+
+func CreateAPIKey(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	if rejectAPIKeyAuth(c) {
+		return
+	}
+
+	var req struct {
+		Name          string    `json:"name" binding:"required"`
+		Scopes        []string  `json:"scopes" binding:"required"`
+		ExpiresAt     time.Time `json:"expiresAt"`
+		ExpiresInDays int       `json:"expiresInDays"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.ExpiresInDays > 0 {
+		req.ExpiresAt = time.Now().Add(time.Hour * 24 * time.Duration(req.ExpiresInDays))
+	}
+	if !req.ExpiresAt.IsZero() && req.ExpiresAt.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expiry must be in the future"})
+		return
+	}
+
+	rawKey := apiKeyPrefix + strings.TrimRight(helpers.GenerateRandomToken(32), "=")
+	key := database.APIKey{
+		ID:        primitive.NewObjectID(),
+		User:      user.ID,
+		Name:      req.Name,
+		Prefix:    rawKey[:len(apiKeyPrefix)+8],
+		Hash:      database.HashAPIKey(rawKey),
+		Scopes:    req.Scopes,
+		CreatedAt: time.Now(),
+		ExpiresAt: req.ExpiresAt,
+	}
+	if _, err := database.CreateAPIKey(key); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// the plaintext key is only ever returned here
+	c.JSON(http.StatusOK, gin.H{"message": "API key created successfully", "key": rawKey, "apiKey": key})
+}
+
+func RevokeAPIKey(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	if rejectAPIKeyAuth(c) {
+		return
+	}
+
+	objID, err := primitive.ObjectIDFromHex(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	if _, err := database.RevokeAPIKey(objID, user.ID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked successfully"})
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -36,11 +37,7 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub": user.ID,
-		"exp": time.Now().Add(time.Hour * 24 * 30).Unix(),
-	})
-	tokenString, err := token.SignedString([]byte(os.Getenv("SECRET")))
+	tokenString, err := generateUserToken(c, user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to return token"})
 		return
@@ -51,6 +48,31 @@ func Login(c *gin.Context) {
 
 }
 
+// generateUserToken records a new session for the request's device and
+// issues the JWT understood by AuthenticationMiddleware.
+func generateUserToken(c *gin.Context, user database.User) (string, error) {
+	now := time.Now()
+	session := database.Session{
+		ID:         primitive.NewObjectID(),
+		User:       user.ID,
+		UserAgent:  c.Request.UserAgent(),
+		IP:         c.ClientIP(),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(time.Hour * 24 * 30),
+	}
+	if _, err := database.CreateSession(session); err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": user.ID,
+		"sid": session.ID.Hex(),
+		"exp": session.ExpiresAt.Unix(),
+	})
+	return token.SignedString([]byte(os.Getenv("SECRET")))
+}
+
 func RequestResetPassword(c *gin.Context) {
 	var req struct {
 		Email    string `json:"email" binding:"omitempty,email"`
@@ -129,21 +151,9 @@ func ResetPassword(c *gin.Context) {
 		return
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), 10)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
-		return
-	}
-
-	updatedData := bson.M{
-		"password":             string(hashedPassword),
-		"passwordResetToken":   "",
-		"passwordResetExpires": time.Time{},
-	}
-
-	_, err = database.UpdateUser(user.ID, updatedData)
+	_, err = database.ResetPassword(user.ID, req.Password)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
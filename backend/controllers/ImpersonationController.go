@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"hermes/database"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultImpersonationMinutes = 60
+	maxImpersonationMinutes     = 240
+)
+
+func StartImpersonation(c *gin.Context) {
+	var admin database.User
+	if val, ok := c.Get("user"); ok {
+		admin = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	if _, ok := c.Get("impersonator"); ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot impersonate while impersonating"})
+		return
+	}
+
+	objID, err := primitive.ObjectIDFromHex(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	target, err := database.GetUserByID(objID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if target.ID == admin.ID || target.Role == database.UserRole.Admin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admins cannot be impersonated"})
+		return
+	}
+
+	minutes := defaultImpersonationMinutes
+	if val := c.Query("minutes"); val != "" {
+		minutes, err = strconv.Atoi(val)
+		if err != nil || minutes <= 0 || minutes > maxImpersonationMinutes {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "minutes must be between 1 and " + strconv.Itoa(maxImpersonationMinutes)})
+			return
+		}
+	}
+
+	now := time.Now()
+	session := database.Session{
+		ID:           primitive.NewObjectID(),
+		User:         target.ID,
+		UserAgent:    c.Request.UserAgent(),
+		IP:           c.ClientIP(),
+		CreatedAt:    now,
+		LastSeenAt:   now,
+		ExpiresAt:    now.Add(time.Minute * time.Duration(minutes)),
+		Impersonator: admin.ID,
+	}
+	if _, err := database.CreateSession(session); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start impersonation"})
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": target.ID,
+		"sid": session.ID.Hex(),
+		"act": admin.ID.Hex(),
+		"exp": session.ExpiresAt.Unix(),
+	})
+	tokenString, err := token.SignedString([]byte(os.Getenv("SECRET")))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to return token"})
+		return
+	}
+
+	database.CreateAuditEvent(database.AuditEvent{
+		Action:  database.AuditAction.ImpersonationStart,
+		Actor:   admin.ID,
+		Subject: target.ID,
+		Session: session.ID,
+		IP:      c.ClientIP(),
+		Details: "expires " + session.ExpiresAt.Format(time.RFC3339),
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":     "Bearer " + tokenString,
+		"user":      target.ID.Hex(),
+		"expiresAt": session.ExpiresAt,
+	})
+}
+
+// StopImpersonation ends the impersonation session the request was made with.
+func StopImpersonation(c *gin.Context) {
+	impersonator, ok := c.Get("impersonator")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not impersonating"})
+		return
+	}
+	userID := c.MustGet("userID").(primitive.ObjectID)
+	sessionID := c.MustGet("sessionID").(primitive.ObjectID)
+
+	if _, err := database.RevokeSession(sessionID, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to stop impersonation"})
+		return
+	}
+
+	database.CreateAuditEvent(database.AuditEvent{
+		Action:  database.AuditAction.ImpersonationStop,
+		Actor:   impersonator.(primitive.ObjectID),
+		Subject: userID,
+		Session: sessionID,
+		IP:      c.ClientIP(),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Impersonation stopped"})
+}
+
+func GetAuditLog(c *gin.Context) {
+	filter := bson.M{}
+	for _, field := range []string{"actor", "subject", "session"} {
+		if val := c.Query(field); val != "" {
+			objID, err := primitive.ObjectIDFromHex(val)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + field + " ID"})
+				return
+			}
+			filter[field] = objID
+		}
+	}
+	if action := c.Query("action"); action != "" {
+		filter["action"] = action
+	}
+
+	limit := int64(100)
+	if val, err := strconv.ParseInt(c.Query("limit"), 10, 64); err == nil && val > 0 && val <= 1000 {
+		limit = val
+	}
+
+	events, err := database.GetAuditEvents(filter, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve audit log"})
+		return
+	}
+	if events == nil {
+		events = []database.AuditEvent{}
+	}
+	c.JSON(http.StatusOK, gin.H{"events": events})
+}
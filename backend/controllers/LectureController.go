@@ -28,8 +28,16 @@ func CreateLecture(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Lecture created successfully", "id": lecture.ID.Hex()})
 }
 
-// TODO: not completed
+// CreateLectureWithTribune creates a lecture together with a tribune linked
+// to it, so students enrolling in the lecture join its discussion.
 func CreateLectureWithTribune(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
 
 	type Req struct {
 		LectureData database.Lecture `json:"lecture" binding:"required"`
@@ -49,22 +57,30 @@ func CreateLectureWithTribune(c *gin.Context) {
 	if request.TribuneData.ID.IsZero() {
 		request.TribuneData.ID = primitive.NewObjectID()
 	}
+	if request.TribuneData.Name == "" {
+		request.TribuneData.Name = request.LectureData.Name
+	}
+	request.TribuneData.LectureID = request.LectureData.ID
+	request.TribuneData.CourseID = request.LectureData.Course
+	request.TribuneData.Members = nil
+	request.TribuneData.Maintainers = append(request.TribuneData.Maintainers, user.ID)
 
-	lecId, lecErr := database.CreateLecture(request.LectureData)
+	_, lecErr := database.CreateLecture(request.LectureData)
 
 	if lecErr != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create Lecture"})
 		return
 	}
 
-	tribId, tribErr := database.CreateTribune(request.TribuneData)
+	_, tribErr := database.CreateTribune(request.TribuneData)
 
 	if tribErr != nil {
+		database.DeleteLecture(request.LectureData.ID)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create Tribune"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Lecture created successfully", "lectureId": lecId.InsertedID, "tribuneId": tribId.InsertedID})
+	c.JSON(http.StatusOK, gin.H{"message": "Lecture created successfully", "lectureId": request.LectureData.ID.Hex(), "tribuneId": request.TribuneData.ID.Hex()})
 }
 
 func GetLecture(c *gin.Context) {
@@ -184,6 +200,7 @@ func EnrollUserInLecture(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	database.EmitWebhookEvent(database.WebhookEvent.EnrollmentCreated, gin.H{"user": userObjID, "lecture": lectureObjID})
 
 	c.JSON(http.StatusOK, gin.H{"message": "User enrolled successfully", "modified_count": result.ModifiedCount})
 }
@@ -213,5 +230,6 @@ func UnEnrollUserInLecture(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	database.EmitWebhookEvent(database.WebhookEvent.EnrollmentRemoved, gin.H{"user": userObjID, "lecture": lectureObjID})
 	c.JSON(http.StatusOK, gin.H{"message": "User Unenrolled successfully"})
 }
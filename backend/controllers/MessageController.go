@@ -0,0 +1,688 @@
+package controllers
+
+import (
+	"hermes/database"
+	"hermes/helpers"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	maxMessageLength = 10000
+	maxChoiceOptions = 20
+)
+
+// studentMessageKinds are the kinds enrolled students may post when the
+// tribune allows discussion. Everything else is reserved to maintainers.
+var studentMessageKinds = map[string]bool{
+	database.MessageKind.PlainText: true,
+	database.MessageKind.File:      true,
+}
+
+func canModerateTribune(user database.User, tribune database.Tribune) bool {
+	return tribune.IsMaintainer(user.ID) || user.Role == database.UserRole.Admin
+}
+
+func PostTribuneMessage(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	tribuneID, err := primitive.ObjectIDFromHex(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tribune ID"})
+		return
+	}
+	tribune, err := database.GetTribuneByID(tribuneID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tribune not found"})
+		return
+	}
+
+	// file messages are uploaded as a form with the file and an optional
+	// caption in content, every other kind is sent as JSON
+	var message database.Message
+	var upload *multipart.FileHeader
+	if c.ContentType() == "multipart/form-data" {
+		upload, err = c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A file message needs a file"})
+			return
+		}
+		file := &database.File{}
+		file.Kind = database.MessageKind.File
+		file.Content = c.PostForm("content")
+		file.Filename = upload.Filename
+		message = file
+	} else {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read body"})
+			return
+		}
+		message, err = database.DecodeMessageJSON(body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if message.GetKind() == database.MessageKind.File {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Files must be uploaded as multipart/form-data"})
+			return
+		}
+	}
+
+	// a reply always joins the thread of the root message
+	var root database.Message
+	if val := c.Query("replyTo"); val != "" {
+		parentID, err := primitive.ObjectIDFromHex(val)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reply ID"})
+			return
+		}
+		root, err = database.GetMessageByID(parentID)
+		if err == nil && !root.Base().ReplyTo.IsZero() {
+			root, err = database.GetMessageByID(root.Base().ReplyTo)
+		}
+		if err != nil || root.Base().Deleted || root.Base().Tribune != tribune.ID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Message to reply to not found"})
+			return
+		}
+		if !studentMessageKinds[message.GetKind()] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Replies cannot be " + message.GetKind() + " messages"})
+			return
+		}
+	}
+
+	maintainer := canModerateTribune(user, tribune)
+	if !maintainer {
+		if !tribune.AllowStudentPosts || !tribune.IsMember(user.ID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You cannot post in this tribune"})
+			return
+		}
+		if !studentMessageKinds[message.GetKind()] {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only maintainers can post " + message.GetKind() + " messages"})
+			return
+		}
+	}
+
+	if mute, muted := database.GetActiveMute(tribune.ID, user.ID); muted {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are muted in this tribune", "until": mute.Until})
+		return
+	}
+
+	content := strings.TrimSpace(message.GetContent())
+	if content == "" && message.GetKind() != database.MessageKind.File {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Message content cannot be empty"})
+		return
+	}
+	if len(content) > maxMessageLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Message is too long"})
+		return
+	}
+	// poll options, quiz questions and other text fields are filtered with
+	// the content
+	message.Base().Content = content
+	if err := database.ApplyMessageWordFilters(tribune.ID, message); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	content = message.GetContent()
+
+	mentioned, err := resolveMentions(tribune, user, content)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve mentions"})
+		return
+	}
+
+	// never trust ownership or moderation fields sent by the client
+	base := message.Base()
+	*base = database.MessageBase{
+		ID:       primitive.NewObjectID(),
+		Kind:     base.Kind,
+		Content:  content,
+		User:     user.ID,
+		Date:     primitive.NewDateTimeFromTime(time.Now()),
+		Question: base.Question && root == nil,
+	}
+	for _, member := range mentioned {
+		base.Mentions = append(base.Mentions, member.ID)
+	}
+	if assignment, ok := message.(*database.Assignment); ok {
+		switch assignment.LatePolicy {
+		case "":
+			assignment.LatePolicy = database.LatePolicy.Reject
+		case database.LatePolicy.Reject, database.LatePolicy.Accept, database.LatePolicy.Penalty:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid late policy"})
+			return
+		}
+		if assignment.LatePenalty < 0 || assignment.LatePenalty > 100 || assignment.MaxGrade < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid grading settings"})
+			return
+		}
+	}
+	if poll, ok := message.(*database.Poll); ok {
+		if len(poll.Options) < 2 || len(poll.Options) > maxChoiceOptions {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A poll needs between two and twenty options"})
+			return
+		}
+		for i := range poll.Options {
+			poll.Options[i].Text = strings.TrimSpace(poll.Options[i].Text)
+			if poll.Options[i].Text == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Poll options cannot be empty"})
+				return
+			}
+			poll.Options[i].ID = primitive.NewObjectID()
+			poll.Options[i].Votes = []primitive.ObjectID{}
+		}
+	}
+	if quiz, ok := message.(*database.Quiz); ok {
+		if err := prepareQuiz(quiz); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if file, ok := message.(*database.File); ok {
+		stored, err := database.UploadFile(database.MessageFileBucket, upload)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// keep the name the word filters left
+		stored.Filename = file.Filename
+		file.StoredFile = stored
+	}
+
+	if root != nil {
+		if result, err := database.PostReply(message, root); err != nil {
+			if result == nil {
+				discardMessageFile(message)
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to post reply"})
+			return
+		}
+		if root.GetUser() != user.ID {
+			helpers.SendNotification(root.GetUser(), user.Name, "New reply in %s: %s", tribune.Name, preview(content))
+		}
+		// the read position is left alone, replying in an old thread does not
+		// mean the newer messages of the tribune were read
+		notifyMentions(mentioned, user, tribune, content)
+		database.RedactMessage(message)
+		helpers.SendTribuneEvent(tribune.ID, "message.created", message)
+		emitMessageWebhook(message)
+		c.JSON(http.StatusOK, gin.H{"message": "Reply posted successfully", "id": base.ID.Hex()})
+		return
+	}
+
+	if _, err := database.PostMessage(message, tribune.ID); err != nil {
+		discardMessageFile(message)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to post message"})
+		return
+	}
+
+	helpers.SendNotification(tribune.ID, user.Name, "New %s in %s: %s", message.GetKind(), tribune.Name, preview(content))
+	notifyMentions(mentioned, user, tribune, content)
+	database.MarkTribuneRead(tribune.ID, user.ID, base.ID)
+	database.RedactMessage(message)
+	helpers.SendTribuneEvent(tribune.ID, "message.created", message)
+	emitMessageWebhook(message)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Message posted successfully", "id": base.ID.Hex()})
+}
+
+// discardMessageFile removes the upload of a file message that could not be
+// posted.
+func discardMessageFile(message database.Message) {
+	file, ok := message.(*database.File)
+	if !ok || file.FileID.IsZero() {
+		return
+	}
+	if err := database.DeleteFile(database.MessageFileBucket, file.FileID); err != nil {
+		log.Printf("failed to delete message file %s: %v", file.FileID.Hex(), err)
+	}
+}
+
+func EditTribuneMessage(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	messageID, err := primitive.ObjectIDFromHex(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	var req struct {
+		Content string `json:"content" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	content := strings.TrimSpace(req.Content)
+	if content == "" || len(content) > maxMessageLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message content"})
+		return
+	}
+
+	message, err := database.GetMessageByID(messageID)
+	if err != nil || message.Base().Deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+	if message.GetUser() != user.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only edit your own messages"})
+		return
+	}
+	tribuneID := message.Base().Tribune
+	if mute, muted := database.GetActiveMute(tribuneID, user.ID); muted {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are muted in this tribune", "until": mute.Until})
+		return
+	}
+	if content, err = database.ApplyWordFilters(tribuneID, content); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := database.EditMessage(messageID, content); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	helpers.SendTribuneEvent(tribuneID, "message.edited", gin.H{"id": messageID, "content": content})
+	c.JSON(http.StatusOK, gin.H{"message": "Message updated successfully", "id": messageID.Hex()})
+}
+
+func DeleteTribuneMessage(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	messageID, err := primitive.ObjectIDFromHex(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	message, err := database.GetMessageByID(messageID)
+	if err != nil || message.Base().Deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+	moderated := message.GetUser() != user.ID
+	if moderated {
+		tribune, err := database.GetTribuneByID(message.Base().Tribune)
+		if err != nil || !canModerateContent(user, tribune) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You cannot delete this message"})
+			return
+		}
+	}
+
+	if _, err := database.DeleteMessage(messageID, user.ID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if moderated {
+		database.ResolveReports(messageID, database.ModerationAction.Delete, user.ID)
+		recordModeration(c, database.AuditAction.ModerationDelete, user, message.Base().Tribune, messageID, message.GetUser(), "")
+	}
+	helpers.SendTribuneEvent(message.Base().Tribune, "message.deleted", gin.H{"id": messageID})
+	c.JSON(http.StatusOK, gin.H{"message": "Message deleted successfully"})
+}
+
+func GetMessageThread(c *gin.Context) {
+	rootID, err := primitive.ObjectIDFromHex(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+	before, after, limit, ok := pageCursors(c)
+	if !ok {
+		return
+	}
+
+	root, err := database.GetMessageByID(rootID)
+	if err != nil || !root.Base().ReplyTo.IsZero() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Thread not found"})
+		return
+	}
+	tribune, err := database.GetTribuneByID(root.Base().Tribune)
+	if err != nil || !canReadTribune(c, tribune) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this tribune"})
+		return
+	}
+	database.RedactMessage(root)
+
+	page, err := database.GetThreadReplies(rootID, before, after, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve replies"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"root":     database.MessageList{root},
+		"messages": page.Messages,
+		"before":   page.Before.Hex(),
+		"after":    page.After.Hex(),
+		"hasMore":  page.HasMore,
+	})
+}
+
+// DownloadMessageFile streams the attachment of a file message to the
+// members of its tribune.
+func DownloadMessageFile(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	messageID, err := primitive.ObjectIDFromHex(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+	message, err := database.GetMessageByID(messageID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	file, ok := message.(*database.File)
+	if !ok || file.Deleted || file.FileID.IsZero() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	tribune, err := database.GetTribuneByID(file.Tribune)
+	if err != nil || !canUserReadTribune(user, tribune) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this tribune"})
+		return
+	}
+	if file.Hidden && !canModerateTribune(user, tribune) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	c.Header("Content-Type", file.ContentType)
+	c.Header("Content-Disposition", "attachment; filename=\""+strings.ReplaceAll(file.Filename, "\"", "")+"\"")
+	if err := database.DownloadFile(database.MessageFileBucket, file.FileID, c.Writer); err != nil {
+		log.Printf("failed to stream message file %s: %v", file.FileID.Hex(), err)
+	}
+}
+
+// loadReactionTarget resolves the message named by the "id" query parameter
+// and checks that the user can see the tribune it was posted in.
+func loadReactionTarget(c *gin.Context, user database.User) (database.Message, bool) {
+	messageID, err := primitive.ObjectIDFromHex(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return nil, false
+	}
+	message, err := database.GetMessageByID(messageID)
+	if err != nil || message.Base().Deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return nil, false
+	}
+	tribune, err := database.GetTribuneByID(message.Base().Tribune)
+	if err != nil || !(tribune.IsMember(user.ID) || canModerateTribune(user, tribune)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot react in this tribune"})
+		return nil, false
+	}
+	return message, true
+}
+
+func AddMessageReaction(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	emoji := c.Query("emoji")
+	if !database.IsValidReaction(emoji) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reaction"})
+		return
+	}
+	message, ok := loadReactionTarget(c, user)
+	if !ok {
+		return
+	}
+
+	if _, err := database.AddReaction(message.GetID(), emoji, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add reaction"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Reaction added successfully"})
+}
+
+func RemoveMessageReaction(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	emoji := c.Query("emoji")
+	if !database.IsValidReaction(emoji) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reaction"})
+		return
+	}
+	message, ok := loadReactionTarget(c, user)
+	if !ok {
+		return
+	}
+
+	if _, err := database.RemoveReaction(message.GetID(), emoji, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove reaction"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Reaction removed successfully"})
+}
+
+// loadQuestion resolves the question thread named by the "id" query
+// parameter and checks that the user maintains its tribune.
+func loadQuestion(c *gin.Context, user database.User) (database.Message, bool) {
+	rootID, err := primitive.ObjectIDFromHex(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return nil, false
+	}
+	root, err := database.GetMessageByID(rootID)
+	if err != nil || root.Base().Deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return nil, false
+	}
+	if !root.Base().Question {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Message is not a question"})
+		return nil, false
+	}
+	tribune, err := database.GetTribuneByID(root.Base().Tribune)
+	if err != nil || !canModerateTribune(user, tribune) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not maintain this tribune"})
+		return nil, false
+	}
+	return root, true
+}
+
+func MarkQuestionAnswered(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	root, ok := loadQuestion(c, user)
+	if !ok {
+		return
+	}
+
+	var answerID primitive.ObjectID
+	if val := c.Query("answer"); val != "" {
+		var err error
+		answerID, err = primitive.ObjectIDFromHex(val)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid answer ID"})
+			return
+		}
+		answer, err := database.GetMessageByID(answerID)
+		if err != nil || answer.Base().Deleted || answer.Base().ReplyTo != root.GetID() {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Answer not found in this thread"})
+			return
+		}
+	}
+
+	if _, err := database.MarkAnswered(root.GetID(), answerID, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark question as answered"})
+		return
+	}
+	if root.GetUser() != user.ID {
+		helpers.SendNotification(root.GetUser(), user.Name, "Your question has been answered: %s", preview(root.GetContent()))
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Question marked as answered successfully"})
+}
+
+func UnmarkQuestionAnswered(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	root, ok := loadQuestion(c, user)
+	if !ok {
+		return
+	}
+	if _, err := database.UnmarkAnswered(root.GetID()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unmark question"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Question unmarked successfully"})
+}
+
+// resolveMentions returns the tribune members mentioned in content, leaving
+// out the author and users who cannot see the tribune.
+func resolveMentions(tribune database.Tribune, author database.User, content string) ([]database.User, error) {
+	usernames := helpers.ParseMentions(content)
+	if len(usernames) == 0 {
+		return nil, nil
+	}
+	users, err := database.GetUsersByUsernames(usernames)
+	if err != nil {
+		return nil, err
+	}
+	members := []database.User{}
+	for _, mentioned := range users {
+		if mentioned.ID != author.ID && tribune.IsMember(mentioned.ID) {
+			members = append(members, mentioned)
+		}
+	}
+	return members, nil
+}
+
+func notifyMentions(mentioned []database.User, author database.User, tribune database.Tribune, content string) {
+	for _, member := range mentioned {
+		helpers.SendNotification(member.ID, author.Name, "%s mentioned you in %s: %s", author.Name, tribune.Name, preview(content))
+	}
+}
+
+// MarkTribuneRead records that the user has read a tribune up to the message
+// named by "message", or up to its newest message.
+func MarkTribuneRead(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	tribuneID, err := primitive.ObjectIDFromHex(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tribune ID"})
+		return
+	}
+	tribune, err := database.GetTribuneByID(tribuneID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tribune not found"})
+		return
+	}
+	if !tribune.IsMember(user.ID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this tribune"})
+		return
+	}
+
+	var messageID primitive.ObjectID
+	if val := c.Query("message"); val != "" {
+		if messageID, err = primitive.ObjectIDFromHex(val); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+			return
+		}
+		message, err := database.GetMessageByID(messageID)
+		if err != nil || message.Base().Tribune != tribune.ID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+			return
+		}
+	} else if messageID, err = database.GetLatestMessageID(tribune.ID); err != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "Nothing to mark as read"})
+		return
+	}
+
+	if _, err := database.MarkTribuneRead(tribune.ID, user.ID, messageID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark tribune as read"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Tribune marked as read successfully", "lastRead": messageID.Hex()})
+}
+
+// preview shortens message content for notifications.
+func preview(content string) string {
+	runes := []rune(content)
+	if len(runes) > 80 {
+		return string(runes[:80]) + "..."
+	}
+	return content
+}
+
+// emitMessageWebhook tells webhooks subscribed to tribune messages about a
+// new message or reply.
+func emitMessageWebhook(message database.Message) {
+	base := message.Base()
+	database.EmitWebhookEvent(database.WebhookEvent.MessagePosted, gin.H{
+		"id":      base.ID,
+		"tribune": base.Tribune,
+		"kind":    message.GetKind(),
+		"user":    base.User,
+		"content": base.Content,
+		"replyTo": base.ReplyTo,
+		"date":    base.Date,
+	})
+}
@@ -0,0 +1,511 @@
+package controllers
+
+import (
+	"fmt"
+	"hermes/database"
+	"hermes/helpers"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const maxMuteMinutes = 30 * 24 * 60
+
+// canModerateContent reports whether the user may act on reports in a
+// tribune: its maintainers, admins and global moderators.
+func canModerateContent(user database.User, tribune database.Tribune) bool {
+	return canModerateTribune(user, tribune) || user.Role == database.UserRole.Moderator
+}
+
+func isGlobalModerator(user database.User) bool {
+	return user.Role == database.UserRole.Admin || user.Role == database.UserRole.Moderator
+}
+
+func recordModeration(c *gin.Context, action string, actor database.User, tribune primitive.ObjectID, target primitive.ObjectID, subject primitive.ObjectID, details string) {
+	database.CreateAuditEvent(database.AuditEvent{
+		Action:  action,
+		Actor:   actor.ID,
+		Subject: subject,
+		Tribune: tribune,
+		Target:  target,
+		IP:      c.ClientIP(),
+		Details: details,
+	})
+}
+
+func ReportMessage(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	messageID, err := primitive.ObjectIDFromHex(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+	var req struct {
+		Reason  string `json:"reason" binding:"required"`
+		Details string `json:"details"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !database.IsValidReportReason(req.Reason) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reason", "reasons": database.ReportReasons})
+		return
+	}
+	details := strings.TrimSpace(req.Details)
+	if len(details) > 1000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Details are too long"})
+		return
+	}
+
+	message, err := database.GetMessageByID(messageID)
+	if err != nil || message.Base().Deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+	if message.GetUser() == user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot report your own message"})
+		return
+	}
+	tribune, err := database.GetTribuneByID(message.Base().Tribune)
+	if err != nil || !tribune.IsMember(user.ID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this tribune"})
+		return
+	}
+
+	report := database.Report{
+		ID:       primitive.NewObjectID(),
+		Message:  messageID,
+		Tribune:  tribune.ID,
+		Reporter: user.ID,
+		Author:   message.GetUser(),
+		Reason:   req.Reason,
+		Details:  details,
+		Content:  message.GetContent(),
+	}
+	if _, err := database.CreateReport(report); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Message reported successfully", "id": report.ID.Hex()})
+}
+
+// GetReportQueue lists reports for moderators. Tribune maintainers see the
+// reports of the tribunes they maintain, global moderators see all of them.
+func GetReportQueue(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	status := c.DefaultQuery("status", database.ReportStatus.Open)
+	filter := bson.M{"status": status}
+	if val := c.Query("tribune"); val != "" {
+		tribuneID, err := primitive.ObjectIDFromHex(val)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tribune ID"})
+			return
+		}
+		tribune, err := database.GetTribuneByID(tribuneID)
+		if err != nil || !canModerateContent(user, tribune) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not moderate this tribune"})
+			return
+		}
+		filter["tribune"] = tribuneID
+	} else if !isGlobalModerator(user) {
+		tribunes, err := database.GetTribunesForUser(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tribunes"})
+			return
+		}
+		maintained := []primitive.ObjectID{}
+		for _, tribune := range tribunes {
+			if tribune.IsMaintainer(user.ID) {
+				maintained = append(maintained, tribune.ID)
+			}
+		}
+		filter["tribune"] = bson.M{"$in": maintained}
+	}
+
+	limit := int64(100)
+	if val, err := strconv.ParseInt(c.Query("limit"), 10, 64); err == nil && val > 0 && val <= 500 {
+		limit = val
+	}
+
+	reports, err := database.GetReports(filter, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve reports"})
+		return
+	}
+	if reports == nil {
+		reports = []database.Report{}
+	}
+	c.JSON(http.StatusOK, gin.H{"reports": reports})
+}
+
+// ModerateMessage applies a moderation action to a message and closes the
+// open reports on it. The message is named by "id", or through a report by
+// "report".
+func ModerateMessage(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var messageID primitive.ObjectID
+	var err error
+	if val := c.Query("report"); val != "" {
+		reportID, err := primitive.ObjectIDFromHex(val)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid report ID"})
+			return
+		}
+		report, err := database.GetReportByID(reportID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Report not found"})
+			return
+		}
+		messageID = report.Message
+	} else if messageID, err = primitive.ObjectIDFromHex(c.Query("id")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	var req struct {
+		Action  string `json:"action" binding:"required"`
+		Reason  string `json:"reason"`
+		Minutes int    `json:"minutes"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	reason := strings.TrimSpace(req.Reason)
+
+	message, err := database.GetMessageByID(messageID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+	tribune, err := database.GetTribuneByID(message.Base().Tribune)
+	if err != nil || !canModerateContent(user, tribune) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not moderate this tribune"})
+		return
+	}
+	author := message.GetUser()
+	if author == user.ID && req.Action != database.ModerationAction.Dismiss {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot moderate your own message"})
+		return
+	}
+
+	var auditAction string
+	switch req.Action {
+	case database.ModerationAction.Hide, database.ModerationAction.Unhide:
+		hide := req.Action == database.ModerationAction.Hide
+		if _, err := database.SetMessageHidden(messageID, hide, user.ID); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		auditAction = database.AuditAction.ModerationUnhide
+		if hide {
+			auditAction = database.AuditAction.ModerationHide
+		}
+	case database.ModerationAction.Delete:
+		if _, err := database.DeleteMessage(messageID, user.ID); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		auditAction = database.AuditAction.ModerationDelete
+	case database.ModerationAction.Warn:
+		text := "Your message in " + tribune.Name + " was flagged by a moderator"
+		if reason != "" {
+			text += ": " + reason
+		}
+		helpers.SendNotification(author, user.Name, "%s", text)
+		auditAction = database.AuditAction.ModerationWarn
+	case database.ModerationAction.Mute:
+		if req.Minutes <= 0 || req.Minutes > maxMuteMinutes {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Mute duration must be between 1 and %d minutes", maxMuteMinutes)})
+			return
+		}
+		if tribune.IsMaintainer(author) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Maintainers cannot be muted"})
+			return
+		}
+		until := time.Now().Add(time.Duration(req.Minutes) * time.Minute)
+		if _, err := database.MuteUser(database.Mute{
+			Tribune: tribune.ID,
+			User:    author,
+			Reason:  reason,
+			MutedBy: user.ID,
+			Until:   until,
+		}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mute user"})
+			return
+		}
+		helpers.SendNotification(author, user.Name, "You have been muted in %s until %s", tribune.Name, until.Format(time.RFC1123))
+		auditAction = database.AuditAction.ModerationMute
+		reason = strings.TrimSpace(fmt.Sprintf("%d minutes %s", req.Minutes, reason))
+	case database.ModerationAction.Dismiss:
+		auditAction = database.AuditAction.ModerationDismiss
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown moderation action"})
+		return
+	}
+
+	if _, err := database.ResolveReports(messageID, req.Action, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve reports"})
+		return
+	}
+	recordModeration(c, auditAction, user, tribune.ID, messageID, author, reason)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Moderation action applied successfully", "action": req.Action})
+}
+
+// loadModeratedTribune resolves the tribune named by the "tribune" query
+// parameter and checks the user moderates it.
+func loadModeratedTribune(c *gin.Context, user database.User) (database.Tribune, bool) {
+	var tribune database.Tribune
+	tribuneID, err := primitive.ObjectIDFromHex(c.Query("tribune"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tribune ID"})
+		return tribune, false
+	}
+	tribune, err = database.GetTribuneByID(tribuneID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tribune not found"})
+		return tribune, false
+	}
+	if !canModerateContent(user, tribune) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not moderate this tribune"})
+		return tribune, false
+	}
+	return tribune, true
+}
+
+func GetTribuneMutes(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	tribune, ok := loadModeratedTribune(c, user)
+	if !ok {
+		return
+	}
+	mutes, err := database.GetActiveMutes(tribune.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve mutes"})
+		return
+	}
+	if mutes == nil {
+		mutes = []database.Mute{}
+	}
+	c.JSON(http.StatusOK, gin.H{"mutes": mutes})
+}
+
+func UnmuteTribuneUser(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	tribune, ok := loadModeratedTribune(c, user)
+	if !ok {
+		return
+	}
+	userID, err := primitive.ObjectIDFromHex(c.Query("user"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	result, err := database.UnmuteUser(tribune.ID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unmute user"})
+		return
+	}
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User is not muted"})
+		return
+	}
+	recordModeration(c, database.AuditAction.ModerationUnmute, user, tribune.ID, primitive.NilObjectID, userID, "")
+	c.JSON(http.StatusOK, gin.H{"message": "User unmuted successfully"})
+}
+
+// GetWordFilters lists the filters of a tribune, or the global filters when
+// no tribune is given.
+func GetWordFilters(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var tribuneID primitive.ObjectID
+	if c.Query("tribune") != "" {
+		tribune, ok := loadModeratedTribune(c, user)
+		if !ok {
+			return
+		}
+		tribuneID = tribune.ID
+	} else if !isGlobalModerator(user) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only moderators can manage global filters"})
+		return
+	}
+
+	filters, err := database.GetWordFilters(tribuneID, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve filters"})
+		return
+	}
+	if filters == nil {
+		filters = []database.WordFilter{}
+	}
+	c.JSON(http.StatusOK, gin.H{"filters": filters})
+}
+
+func CreateWordFilter(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var tribuneID primitive.ObjectID
+	if c.Query("tribune") != "" {
+		tribune, ok := loadModeratedTribune(c, user)
+		if !ok {
+			return
+		}
+		tribuneID = tribune.ID
+	} else if !isGlobalModerator(user) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only moderators can manage global filters"})
+		return
+	}
+
+	var req struct {
+		Word   string `json:"word" binding:"required"`
+		Action string `json:"action"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Action == "" {
+		req.Action = database.WordFilterAction.Block
+	}
+
+	filter := database.WordFilter{
+		ID:        primitive.NewObjectID(),
+		Tribune:   tribuneID,
+		Word:      req.Word,
+		Action:    req.Action,
+		CreatedBy: user.ID,
+	}
+	if _, err := database.CreateWordFilter(filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	recordModeration(c, database.AuditAction.ModerationFilterAdd, user, tribuneID, filter.ID, primitive.NilObjectID, req.Action+" "+strings.TrimSpace(req.Word))
+	c.JSON(http.StatusOK, gin.H{"message": "Filter created successfully", "id": filter.ID.Hex()})
+}
+
+func DeleteWordFilter(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	filterID, err := primitive.ObjectIDFromHex(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filter ID"})
+		return
+	}
+	filter, err := database.GetWordFilterByID(filterID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Filter not found"})
+		return
+	}
+	if filter.Tribune.IsZero() {
+		if !isGlobalModerator(user) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only moderators can manage global filters"})
+			return
+		}
+	} else {
+		tribune, err := database.GetTribuneByID(filter.Tribune)
+		if err != nil || !canModerateContent(user, tribune) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not moderate this tribune"})
+			return
+		}
+	}
+
+	if _, err := database.DeleteWordFilter(filterID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete filter"})
+		return
+	}
+	recordModeration(c, database.AuditAction.ModerationFilterDrop, user, filter.Tribune, filter.ID, primitive.NilObjectID, filter.Action+" "+filter.Word)
+	c.JSON(http.StatusOK, gin.H{"message": "Filter deleted successfully"})
+}
+
+// GetModerationLog returns the moderation actions taken in a tribune.
+func GetModerationLog(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	tribune, ok := loadModeratedTribune(c, user)
+	if !ok {
+		return
+	}
+	limit := int64(100)
+	if val, err := strconv.ParseInt(c.Query("limit"), 10, 64); err == nil && val > 0 && val <= 1000 {
+		limit = val
+	}
+
+	filter := bson.M{"tribune": tribune.ID, "action": bson.M{"$regex": "^moderation\\."}}
+	events, err := database.GetAuditEvents(filter, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve moderation log"})
+		return
+	}
+	if events == nil {
+		events = []database.AuditEvent{}
+	}
+	c.JSON(http.StatusOK, gin.H{"events": events})
+}
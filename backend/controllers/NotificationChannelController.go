@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"hermes/database"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type channelRequest struct {
+	Name        string               `json:"name" binding:"required"`
+	Description string               `json:"description"`
+	Roles       []string             `json:"roles"`
+	Courses     []primitive.ObjectID `json:"courses"`
+	Public      bool                 `json:"public"`
+	Mandatory   bool                 `json:"mandatory"`
+}
+
+func (req channelRequest) channel() database.NotificationChannel {
+	return database.NotificationChannel{
+		Name:        req.Name,
+		Description: req.Description,
+		Roles:       req.Roles,
+		Courses:     req.Courses,
+		Public:      req.Public,
+		Mandatory:   req.Mandatory,
+	}
+}
+
+// GetNotificationChannels lists the channels the user is subscribed to or
+// may subscribe to. Admins see every channel.
+func GetNotificationChannels(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	channels, err := database.GetNotificationChannels()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get channels"})
+		return
+	}
+	subs, _ := database.GetUserNotificationSubs(user.ID)
+	subscribed := map[primitive.ObjectID]bool{}
+	for _, id := range subs {
+		subscribed[id] = true
+	}
+
+	type channelView struct {
+		database.NotificationChannel
+		Subscribed bool `json:"subscribed"`
+	}
+	views := []channelView{}
+	for _, ch := range channels {
+		if !subscribed[ch.ID] && user.Role != database.UserRole.Admin && !ch.CanSubscribe(user) {
+			continue
+		}
+		views = append(views, channelView{NotificationChannel: ch, Subscribed: subscribed[ch.ID]})
+	}
+	c.JSON(http.StatusOK, views)
+}
+
+func loadNotificationChannel(c *gin.Context) (database.NotificationChannel, bool) {
+	id, err := primitive.ObjectIDFromHex(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid channel ID"})
+		return database.NotificationChannel{}, false
+	}
+	ch, err := database.GetNotificationChannelByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+		return ch, false
+	}
+	return ch, true
+}
+
+func SubscribeToNotificationChannel(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ch, ok := loadNotificationChannel(c)
+	if !ok {
+		return
+	}
+	if !ch.CanSubscribe(user) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot subscribe to this channel"})
+		return
+	}
+
+	if _, err := database.SubscribeToNotification(user.ID, ch.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to subscribe"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Subscribed successfully"})
+}
+
+func UnsubscribeFromNotificationChannel(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ch, ok := loadNotificationChannel(c)
+	if !ok {
+		return
+	}
+	if ch.Mandatory {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This channel cannot be unsubscribed from"})
+		return
+	}
+
+	if _, err := database.UnsubscribeFromNotification(user.ID, ch.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unsubscribe"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Unsubscribed successfully"})
+}
+
+func CreateNotificationChannel(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req channelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ch := req.channel()
+	ch.ID = primitive.NewObjectID()
+	ch.CreatedBy = user.ID
+	if _, err := database.CreateNotificationChannel(ch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Channel created successfully", "id": ch.ID.Hex()})
+}
+
+func UpdateNotificationChannel(c *gin.Context) {
+	ch, ok := loadNotificationChannel(c)
+	if !ok {
+		return
+	}
+
+	var req channelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := database.UpdateNotificationChannel(ch.ID, req.channel()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Channel updated successfully"})
+}
+
+func DeleteNotificationChannel(c *gin.Context) {
+	ch, ok := loadNotificationChannel(c)
+	if !ok {
+		return
+	}
+
+	if _, err := database.DeleteNotificationChannel(ch.ID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Channel deleted successfully"})
+}
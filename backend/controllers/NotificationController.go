@@ -2,18 +2,31 @@ package controllers
 
 import (
 	"encoding/json"
+	"fmt"
 	"hermes/database"
 	"hermes/helpers"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+const (
+	// sseHeartbeatInterval keeps idle connections open through proxies that
+	// close them after a period without traffic.
+	sseHeartbeatInterval = 25 * time.Second
+	// sseReplayLimit caps how many missed notifications are replayed on
+	// reconnect, older ones are still in the inbox.
+	sseReplayLimit = 200
+)
+
 func SSENotificationEndpoint(c *gin.Context) {
 	c.Writer.Header().Set("Content-Type", "text/event-stream")
 	c.Writer.Header().Set("Cache-Control", "no-cache")
 	c.Writer.Header().Set("Connection", "keep-alive")
+	c.Writer.Header().Set("X-Accel-Buffering", "no")
 
 	var userID primitive.ObjectID
 	if val, ok := c.Get("user"); ok {
@@ -23,24 +36,219 @@ func SSENotificationEndpoint(c *gin.Context) {
 		return
 	}
 
-	subs, _ := database.GetUserNotificationSubs(userID)
+	channels := notificationChannels(userID)
+	// subscribe before replaying so nothing published in between is lost,
+	// the replayed notifications are skipped when they arrive live
+	sub := helpers.Notifications.Subscribe(channels...)
+	defer sub.Close()
 
-	for notification := range helpers.NotificationChannel {
-		if contains(subs, notification.ObjectID) {
-			jsonData, err := json.Marshal(notification)
-			if err != nil {
+	fmt.Fprintf(c.Writer, "retry: %d\n\n", 3000)
+
+	replayed := map[int64]bool{}
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("lastEventId")
+	}
+	if lastEventID != "" {
+		if after, err := strconv.ParseInt(lastEventID, 10, 64); err == nil {
+			missed, _ := database.GetNotificationsSince(channels, after, sseReplayLimit)
+			for _, notification := range missed {
+				writeSSENotification(c, notification)
+				replayed[notification.Seq] = true
+			}
+		}
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": heartbeat\n\n")
+			c.Writer.Flush()
+		case notification, ok := <-sub.Events():
+			if !ok {
+				// the hub dropped a subscriber that could not keep up
+				return
+			}
+			if notification.Seq != 0 && replayed[notification.Seq] {
+				delete(replayed, notification.Seq)
 				continue
 			}
-			c.SSEvent("message", string(jsonData))
+			if notification.Event == helpers.SubscriptionsChangedEvent && notification.ObjectID == userID {
+				sub.SetChannels(notificationChannels(userID)...)
+			}
+			writeSSENotification(c, notification)
+			c.Writer.Flush()
 		}
 	}
 }
 
-func contains(slice []primitive.ObjectID, item primitive.ObjectID) bool {
-	for _, a := range slice {
-		if a == item {
-			return true
-		}
+// writeSSENotification writes a notification as an SSE event whose id is its
+// sequence number, so a reconnecting client can resume with Last-Event-ID.
+// Live events are not stored and leave the client's last id as it is.
+func writeSSENotification(c *gin.Context, notification helpers.Notification) {
+	jsonData, err := json.Marshal(notification)
+	if err != nil {
+		return
+	}
+	if notification.Seq != 0 {
+		fmt.Fprintf(c.Writer, "id: %d\n", notification.Seq)
+	}
+	fmt.Fprintf(c.Writer, "event: message\ndata: %s\n\n", jsonData)
+}
+
+// notificationChannels lists the channels a user receives notifications on,
+// including the tribunes they belong to and their own id.
+func notificationChannels(userID primitive.ObjectID) []primitive.ObjectID {
+	channels, err := database.GetUserNotificationChannels(userID)
+	if err != nil {
+		return []primitive.ObjectID{userID}
+	}
+	return channels
+}
+
+func GetNotificationInbox(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	before, after, limit, ok := pageCursors(c)
+	if !ok {
+		return
+	}
+	unreadOnly, _ := strconv.ParseBool(c.Query("unread"))
+
+	page, err := database.GetInbox(user.ID, notificationChannels(user.ID), before, after, limit, unreadOnly)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get notifications"})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+func GetUnreadNotificationCount(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	count, err := database.GetUnreadNotificationCount(user.ID, notificationChannels(user.ID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count notifications"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"unread": count})
+}
+
+func MarkNotificationRead(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification ID"})
+		return
+	}
+
+	if err := database.MarkNotificationRead(user.ID, notificationChannels(user.ID), id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Notification marked as read"})
+}
+
+func MarkAllNotificationsRead(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := database.MarkAllNotificationsRead(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark notifications as read"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Notifications marked as read"})
+}
+
+func GetNotificationPreferences(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	prefs, err := database.GetNotificationPreferences(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get preferences"})
+		return
+	}
+	c.JSON(http.StatusOK, prefs)
+}
+
+func UpdateNotificationPreferences(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	prefs, err := database.GetNotificationPreferences(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get preferences"})
+		return
+	}
+	if err := c.ShouldBindJSON(&prefs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	prefs.User = user.ID
+
+	if err := database.SetNotificationPreferences(prefs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Preferences updated successfully"})
+}
+
+// GetEmailDeliveries lists the notification emails sent to the user and
+// whether they went out.
+func GetEmailDeliveries(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	deliveries, err := database.GetEmailDeliveries(user.ID, 50)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get deliveries"})
+		return
 	}
-	return false
+	c.JSON(http.StatusOK, deliveries)
 }
@@ -0,0 +1,200 @@
+package controllers
+
+import (
+	"fmt"
+	"hermes/database"
+	"hermes/helpers"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// rolePriority orders roles from most to least privileged when a user's IdP
+// groups map to more than one of them.
+var rolePriority = []string{
+	database.UserRole.Admin,
+	database.UserRole.Moderator,
+	database.UserRole.Staff,
+	database.UserRole.Student,
+}
+
+func OIDCLogin(c *gin.Context) {
+	provider, err := helpers.GetOIDCProvider()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	verifier, challenge := helpers.GeneratePKCE()
+	loginState := database.OIDCLoginState{
+		ID:           primitive.NewObjectID(),
+		State:        helpers.GenerateRandomToken(32),
+		Nonce:        helpers.GenerateRandomToken(32),
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(time.Minute * 10),
+	}
+	if _, err := database.CreateOIDCLoginState(loginState); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+
+	c.Redirect(http.StatusFound, provider.AuthCodeURL(loginState.State, loginState.Nonce, challenge))
+}
+
+func OIDCCallback(c *gin.Context) {
+	if idpError := c.Query("error"); idpError != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": idpError, "message": c.Query("error_description")})
+		return
+	}
+	code := c.Query("code")
+	state := c.Query("state")
+	if code == "" || state == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code and state are required"})
+		return
+	}
+
+	provider, err := helpers.GetOIDCProvider()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	loginState, err := database.ConsumeOIDCLoginState(state)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired login state"})
+		return
+	}
+
+	tokens, err := provider.Exchange(code, loginState.CodeVerifier)
+	if err != nil {
+		log.Printf("OIDC exchange failed: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Failed to redeem authorization code"})
+		return
+	}
+
+	claims, err := provider.VerifyIDToken(tokens.IDToken, loginState.Nonce)
+	if err != nil {
+		log.Printf("OIDC verification failed: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid identity token"})
+		return
+	}
+
+	user, err := resolveOIDCUser(provider, claims)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokenString, err := generateUserToken(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to return token"})
+		return
+	}
+
+	// browser flows land back on the frontend with the token in the fragment
+	if redirect := os.Getenv("OIDC_POST_LOGIN_REDIRECT"); redirect != "" {
+		c.Redirect(http.StatusFound, redirect+"#token="+url.QueryEscape("Bearer "+tokenString))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"token": "Bearer " + tokenString,
+	})
+}
+
+// resolveOIDCUser finds the hermes account for the IdP identity, linking an
+// existing account by email or provisioning a new one, and applies the role
+// granted by the user's IdP groups. An account is only linked by an email
+// the IdP has verified, anyone could otherwise take over an account by
+// claiming its address.
+func resolveOIDCUser(provider *helpers.OIDCProvider, claims helpers.OIDCClaims) (database.User, error) {
+	user, err := database.GetUserByOIDCSubject(claims.Subject)
+	if err == mongo.ErrNoDocuments {
+		claims.Email = strings.ToLower(strings.TrimSpace(claims.Email))
+		if claims.Email == "" {
+			return user, fmt.Errorf("identity provider did not return an email")
+		}
+		user, err = database.FindUserByEmail(claims.Email)
+		if err == nil {
+			if err := checkOIDCEmail(provider.Config, claims, true); err != nil {
+				return user, err
+			}
+			_, err = database.UpdateUser(user.ID, bson.M{"oidcSubject": claims.Subject})
+			if err != nil {
+				return user, fmt.Errorf("failed to link account")
+			}
+			user.OIDCSubject = claims.Subject
+		} else if err == mongo.ErrNoDocuments {
+			if err := checkOIDCEmail(provider.Config, claims, false); err != nil {
+				return user, err
+			}
+			user, err = provisionOIDCUser(claims)
+			if err != nil {
+				return user, fmt.Errorf("failed to create account: %s", err.Error())
+			}
+		}
+	}
+	if err != nil {
+		return user, fmt.Errorf("failed to retrieve user")
+	}
+
+	role := provider.MapGroupsToRole(claims.Groups, rolePriority)
+	if role != "" && role != user.Role {
+		if _, err := database.UpdateUser(user.ID, bson.M{"role": role}); err != nil {
+			return user, fmt.Errorf("failed to update role")
+		}
+		user.Role = role
+	}
+	return user, nil
+}
+
+// checkOIDCEmail decides whether an identity without a linked account may
+// be linked to the existing account with its email, or provisioned when
+// there is none.
+func checkOIDCEmail(config helpers.OIDCConfig, claims helpers.OIDCClaims, existing bool) error {
+	if existing {
+		if !claims.EmailVerified {
+			return fmt.Errorf("email is not verified by the identity provider")
+		}
+		return nil
+	}
+	if !config.AutoProvision {
+		return fmt.Errorf("no hermes account exists for %s", claims.Email)
+	}
+	if config.RequireVerifiedEmail && !claims.EmailVerified {
+		return fmt.Errorf("email is not verified by the identity provider")
+	}
+	return nil
+}
+
+func provisionOIDCUser(claims helpers.OIDCClaims) (database.User, error) {
+	email := claims.Email
+	username := claims.PreferredUsername
+	if username == "" || strings.Contains(username, "@") {
+		username = strings.SplitN(email, "@", 2)[0]
+	}
+	name := claims.Name
+	if name == "" {
+		name = username
+	}
+
+	user := database.User{
+		ID:          primitive.NewObjectID(),
+		Username:    username,
+		Email:       email,
+		Name:        name,
+		Role:        database.UserRole.Student,
+		OIDCSubject: claims.Subject,
+	}
+	if _, err := database.CreateSSOUser(user); err != nil {
+		return user, err
+	}
+	return database.GetUserByID(user.ID)
+}
@@ -0,0 +1,231 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"hermes/helpers"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// mockIdP is a minimal OpenID provider: discovery, JWKS and a token
+// endpoint that redeems codes issued by authorize for an ID token with the
+// given claims.
+type mockIdP struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]mockGrant
+}
+
+type mockGrant struct {
+	challenge string
+	nonce     string
+	claims    jwt.MapClaims
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{t: t, key: key, codes: map[string]mockGrant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kid": "test",
+			"kty": "RSA",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// authorize plays the user signing in at the IdP and returns the code the
+// IdP would redirect back with.
+func (idp *mockIdP) authorize(authURL string, claims jwt.MapClaims) string {
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		idp.t.Fatalf("authorization request without PKCE: %s", authURL)
+	}
+	code := helpers.GenerateRandomToken(16)
+	idp.mu.Lock()
+	idp.codes[code] = mockGrant{challenge: query.Get("code_challenge"), nonce: query.Get("nonce"), claims: claims}
+	idp.mu.Unlock()
+	return code
+}
+
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	idp.mu.Lock()
+	grant, ok := idp.codes[r.PostForm.Get("code")]
+	delete(idp.codes, r.PostForm.Get("code"))
+	idp.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   idp.server.URL,
+		"aud":   "hermes",
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": grant.nonce,
+	}
+	for key, value := range grant.claims {
+		claims[key] = value
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	signed, err := token.SignedString(idp.key)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "access", "id_token": signed, "token_type": "Bearer"})
+}
+
+func (idp *mockIdP) provider(t *testing.T, config helpers.OIDCConfig) *helpers.OIDCProvider {
+	config.Issuer = idp.server.URL
+	config.ClientID = "hermes"
+	config.RedirectURL = "http://hermes.test/api/auth/oidc/callback"
+	config.Scopes = []string{"openid", "email"}
+	config.GroupsClaim = "groups"
+	provider, err := helpers.NewOIDCProvider(config)
+	if err != nil {
+		t.Fatalf("discovery failed: %v", err)
+	}
+	return provider
+}
+
+// login runs the authorization code flow against the mock IdP and returns
+// the verified claims.
+func (idp *mockIdP) login(t *testing.T, provider *helpers.OIDCProvider, claims jwt.MapClaims) (helpers.OIDCClaims, error) {
+	verifier, challenge := helpers.GeneratePKCE()
+	nonce := helpers.GenerateRandomToken(16)
+	code := idp.authorize(provider.AuthCodeURL("state", nonce, challenge), claims)
+	tokens, err := provider.Exchange(code, verifier)
+	if err != nil {
+		return helpers.OIDCClaims{}, err
+	}
+	return provider.VerifyIDToken(tokens.IDToken, nonce)
+}
+
+func TestOIDCLoginFlow(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := idp.provider(t, helpers.OIDCConfig{AutoProvision: true})
+
+	claims, err := idp.login(t, provider, jwt.MapClaims{
+		"sub":            "user-1",
+		"email":          "Ada@Example.com",
+		"email_verified": true,
+		"groups":         []string{"teachers"},
+	})
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	if claims.Subject != "user-1" || claims.Email != "Ada@Example.com" || !claims.EmailVerified {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+	if len(claims.Groups) != 1 || claims.Groups[0] != "teachers" {
+		t.Fatalf("unexpected groups: %v", claims.Groups)
+	}
+	if err := checkOIDCEmail(provider.Config, claims, true); err != nil {
+		t.Fatalf("verified email was not linked: %v", err)
+	}
+}
+
+func TestOIDCUnverifiedEmail(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := idp.provider(t, helpers.OIDCConfig{AutoProvision: true})
+
+	claims, err := idp.login(t, provider, jwt.MapClaims{
+		"sub":            "attacker",
+		"email":          "admin@example.com",
+		"email_verified": false,
+	})
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	if claims.EmailVerified {
+		t.Fatal("email_verified false was read as verified")
+	}
+	if err := checkOIDCEmail(provider.Config, claims, true); err == nil {
+		t.Fatal("unverified email was linked to an existing account")
+	}
+	// provisioning a new account only needs a verified email when required
+	if err := checkOIDCEmail(provider.Config, claims, false); err != nil {
+		t.Fatalf("unverified email was not provisioned: %v", err)
+	}
+	provider.Config.RequireVerifiedEmail = true
+	if err := checkOIDCEmail(provider.Config, claims, false); err == nil {
+		t.Fatal("unverified email was provisioned although verification is required")
+	}
+
+	// a missing claim counts as unverified
+	claims, err = idp.login(t, provider, jwt.MapClaims{"sub": "other", "email": "admin@example.com"})
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	if err := checkOIDCEmail(provider.Config, claims, true); err == nil {
+		t.Fatal("email without email_verified was linked to an existing account")
+	}
+}
+
+func TestOIDCRejectsInvalidExchange(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := idp.provider(t, helpers.OIDCConfig{})
+
+	_, challenge := helpers.GeneratePKCE()
+	code := idp.authorize(provider.AuthCodeURL("state", "nonce", challenge), jwt.MapClaims{"sub": "user-1"})
+	wrongVerifier, _ := helpers.GeneratePKCE()
+	if _, err := provider.Exchange(code, wrongVerifier); err == nil {
+		t.Fatal("code was redeemed with the wrong PKCE verifier")
+	}
+
+	verifier, challenge := helpers.GeneratePKCE()
+	code = idp.authorize(provider.AuthCodeURL("state", "nonce", challenge), jwt.MapClaims{"sub": "user-1"})
+	tokens, err := provider.Exchange(code, verifier)
+	if err != nil {
+		t.Fatalf("exchange failed: %v", err)
+	}
+	if _, err := provider.VerifyIDToken(tokens.IDToken, "other-nonce"); err == nil {
+		t.Fatal("id_token was accepted with the wrong nonce")
+	}
+	if _, err := provider.Exchange(code, verifier); err == nil {
+		t.Fatal("code was redeemed twice")
+	}
+}
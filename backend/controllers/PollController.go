@@ -0,0 +1,412 @@
+package controllers
+
+import (
+	"fmt"
+	"hermes/database"
+	"hermes/helpers"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// prepareQuiz validates a new quiz and assigns question ids.
+func prepareQuiz(quiz *database.Quiz) error {
+	if len(quiz.Questions) == 0 {
+		return fmt.Errorf("a quiz needs at least one question")
+	}
+	for i := range quiz.Questions {
+		question := &quiz.Questions[i]
+		question.Text = strings.TrimSpace(question.Text)
+		if question.Text == "" {
+			return fmt.Errorf("question %d has no text", i+1)
+		}
+		if len(question.Options) < 2 || len(question.Options) > maxChoiceOptions {
+			return fmt.Errorf("question %d needs between two and twenty options", i+1)
+		}
+		if len(question.Correct) == 0 {
+			return fmt.Errorf("question %d has no correct option", i+1)
+		}
+		for _, correct := range question.Correct {
+			if correct < 0 || correct >= len(question.Options) {
+				return fmt.Errorf("question %d has an invalid correct option", i+1)
+			}
+		}
+		if question.Points < 0 {
+			return fmt.Errorf("question %d has negative points", i+1)
+		}
+		if question.Points == 0 {
+			question.Points = 1
+		}
+		question.ID = primitive.NewObjectID()
+	}
+	return nil
+}
+
+// pollResults is what voters see: counts for every option, and the voters
+// themselves unless the poll is anonymous.
+func pollResults(poll *database.Poll) gin.H {
+	database.RedactMessage(poll)
+	options := []gin.H{}
+	total := 0
+	for _, option := range poll.Options {
+		entry := gin.H{"id": option.ID.Hex(), "text": option.Text, "count": option.Count}
+		if !poll.Anonymous {
+			entry["votes"] = option.Votes
+		}
+		options = append(options, entry)
+		total += option.Count
+	}
+	return gin.H{
+		"poll":           poll.ID.Hex(),
+		"options":        options,
+		"total":          total,
+		"anonymous":      poll.Anonymous,
+		"multipleChoice": poll.MultipleChoice,
+		"closesAt":       poll.ClosesAt,
+	}
+}
+
+// loadPoll resolves the poll named by the "id" query parameter and checks
+// that the user is a member of its tribune.
+func loadPoll(c *gin.Context, user database.User) (*database.Poll, database.Tribune, bool) {
+	var tribune database.Tribune
+	pollID, err := primitive.ObjectIDFromHex(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid poll ID"})
+		return nil, tribune, false
+	}
+	poll, err := database.GetPoll(pollID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Poll not found"})
+		return nil, tribune, false
+	}
+	tribune, err = database.GetTribuneByID(poll.Tribune)
+	if err != nil || !canReadTribune(c, tribune) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this tribune"})
+		return nil, tribune, false
+	}
+	return poll, tribune, true
+}
+
+// publishPollResults pushes the current results to the WebSocket clients
+// following the tribune.
+func publishPollResults(pollID primitive.ObjectID, tribuneID primitive.ObjectID) {
+	poll, err := database.GetPoll(pollID)
+	if err != nil {
+		return
+	}
+	helpers.SendTribuneEvent(tribuneID, "poll.results", pollResults(poll))
+}
+
+func VotePoll(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req struct {
+		Options []string `json:"options" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	optionIDs := []primitive.ObjectID{}
+	for _, val := range req.Options {
+		optionID, err := primitive.ObjectIDFromHex(val)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid option ID"})
+			return
+		}
+		optionIDs = append(optionIDs, optionID)
+	}
+
+	poll, tribune, ok := loadPoll(c, user)
+	if !ok {
+		return
+	}
+	if !tribune.IsMember(user.ID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot vote in this tribune"})
+		return
+	}
+
+	if err := database.VotePoll(poll, user.ID, optionIDs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	publishPollResults(poll.ID, tribune.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "Vote recorded successfully"})
+}
+
+func RetractPollVote(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	poll, tribune, ok := loadPoll(c, user)
+	if !ok {
+		return
+	}
+	if err := database.RetractPollVote(poll, user.ID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	publishPollResults(poll.ID, tribune.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "Vote retracted successfully"})
+}
+
+func GetPollResults(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	poll, _, ok := loadPoll(c, user)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, pollResults(poll))
+}
+
+// CloseVoting closes a poll or a quiz before its closing time.
+func CloseVoting(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	messageID, err := primitive.ObjectIDFromHex(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+	message, err := database.GetMessageByID(messageID)
+	if err != nil || message.Base().Deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+	kind := message.GetKind()
+	if kind != database.MessageKind.Poll && kind != database.MessageKind.Quiz {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only polls and quizzes can be closed"})
+		return
+	}
+	tribune, err := database.GetTribuneByID(message.Base().Tribune)
+	if err != nil || !canModerateTribune(user, tribune) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not maintain this tribune"})
+		return
+	}
+
+	if _, err := database.CloseMessageVoting(messageID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close " + kind})
+		return
+	}
+	if kind == database.MessageKind.Poll {
+		publishPollResults(messageID, tribune.ID)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Closed successfully"})
+}
+
+// loadQuiz resolves the quiz named by the "id" query parameter together with
+// its tribune.
+func loadQuiz(c *gin.Context) (*database.Quiz, database.Tribune, bool) {
+	var tribune database.Tribune
+	quizID, err := primitive.ObjectIDFromHex(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quiz ID"})
+		return nil, tribune, false
+	}
+	message, err := database.GetMessageByID(quizID)
+	if err != nil || message.Base().Deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Quiz not found"})
+		return nil, tribune, false
+	}
+	quiz, ok := message.(*database.Quiz)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Message is not a quiz"})
+		return nil, tribune, false
+	}
+	tribune, err = database.GetTribuneByID(quiz.Tribune)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tribune not found"})
+		return nil, tribune, false
+	}
+	return quiz, tribune, true
+}
+
+func SubmitQuizAttempt(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req struct {
+		Answers []struct {
+			Question string `json:"question"`
+			Choices  []int  `json:"choices"`
+		} `json:"answers" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	quiz, tribune, ok := loadQuiz(c)
+	if !ok {
+		return
+	}
+	if !tribune.IsMember(user.ID) || tribune.IsMaintainer(user.ID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot answer this quiz"})
+		return
+	}
+	if quiz.IsClosed(time.Now()) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "The quiz is closed"})
+		return
+	}
+
+	answers := []database.QuizAnswer{}
+	for _, answer := range req.Answers {
+		questionID, err := primitive.ObjectIDFromHex(answer.Question)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid question ID"})
+			return
+		}
+		answers = append(answers, database.QuizAnswer{Question: questionID, Choices: answer.Choices})
+	}
+	score, err := database.ScoreQuiz(quiz, answers)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	attempt := database.QuizAttempt{
+		ID:       primitive.NewObjectID(),
+		Quiz:     quiz.ID,
+		Tribune:  tribune.ID,
+		User:     user.ID,
+		Answers:  answers,
+		Score:    score,
+		MaxScore: quiz.MaxScore(),
+	}
+	if _, err := database.SubmitQuizAttempt(attempt); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Quiz submitted successfully", "score": score, "maxScore": attempt.MaxScore})
+}
+
+func GetMyQuizAttempt(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	quiz, _, ok := loadQuiz(c)
+	if !ok {
+		return
+	}
+	attempt, err := database.GetQuizAttempt(quiz.ID, user.ID)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "You have not answered this quiz"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve attempt"})
+		return
+	}
+	c.JSON(http.StatusOK, attempt)
+}
+
+func GetQuizAttempts(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	quiz, tribune, ok := loadQuiz(c)
+	if !ok {
+		return
+	}
+	if !canModerateTribune(user, tribune) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not maintain this tribune"})
+		return
+	}
+	attempts, err := database.GetQuizAttempts(bson.M{"quiz": quiz.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve attempts"})
+		return
+	}
+	if attempts == nil {
+		attempts = []database.QuizAttempt{}
+	}
+	c.JSON(http.StatusOK, gin.H{"attempts": attempts})
+}
+
+// GetGradebook returns assignment grades and quiz scores of a tribune.
+// Maintainers see every member, students only their own row.
+func GetGradebook(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	tribuneID, err := primitive.ObjectIDFromHex(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tribune ID"})
+		return
+	}
+	tribune, err := database.GetTribuneByID(tribuneID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tribune not found"})
+		return
+	}
+
+	var students []primitive.ObjectID
+	if canModerateTribune(user, tribune) {
+		for _, member := range tribune.Members {
+			if !tribune.IsMaintainer(member) {
+				students = append(students, member)
+			}
+		}
+	} else if tribune.IsMember(user.ID) {
+		students = []primitive.ObjectID{user.ID}
+	} else {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this tribune"})
+		return
+	}
+
+	gradebook, err := database.GetGradebook(tribune.ID, students)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build gradebook"})
+		return
+	}
+	c.JSON(http.StatusOK, gradebook)
+}
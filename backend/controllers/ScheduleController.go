@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"hermes/database"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// canTargetChannel reports whether the user may send announcements to a
+// channel. Notification channels are for admins, tribunes for their
+// maintainers. An announcement to a tribune reaches its members and
+// maintainers.
+func canTargetChannel(user database.User, id primitive.ObjectID) bool {
+	if _, err := database.GetNotificationChannelByID(id); err == nil {
+		return user.Role == database.UserRole.Admin
+	}
+	tribune, err := database.GetTribuneByID(id)
+	if err != nil {
+		return false
+	}
+	return canModerateTribune(user, tribune)
+}
+
+func ScheduleAnnouncement(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req struct {
+		Channels   []primitive.ObjectID `json:"channels" binding:"required"`
+		Message    string               `json:"message" binding:"required"`
+		SendAt     time.Time            `json:"sendAt" binding:"required"`
+		Recurrence string               `json:"recurrence"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.SendAt.Before(time.Now().Add(-time.Minute)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Send time is in the past"})
+		return
+	}
+	for _, channel := range req.Channels {
+		if !canTargetChannel(user, channel) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You cannot send announcements to channel " + channel.Hex()})
+			return
+		}
+	}
+
+	announcement := database.ScheduledAnnouncement{
+		ID:         primitive.NewObjectID(),
+		Channels:   req.Channels,
+		Message:    req.Message,
+		Author:     user.Name,
+		CreatedBy:  user.ID,
+		StartAt:    req.SendAt,
+		Recurrence: req.Recurrence,
+	}
+	if _, err := database.CreateScheduledAnnouncement(announcement); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Announcement scheduled successfully", "id": announcement.ID.Hex()})
+}
+
+// GetScheduledAnnouncements lists the user's announcements, or every
+// announcement for admins. With status set only those in that state are
+// returned.
+func GetScheduledAnnouncements(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	filter := bson.M{}
+	if user.Role != database.UserRole.Admin {
+		filter["createdBy"] = user.ID
+	}
+	if status := c.Query("status"); status != "" {
+		filter["status"] = status
+	}
+	announcements, err := database.GetScheduledAnnouncements(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get announcements"})
+		return
+	}
+	c.JSON(http.StatusOK, announcements)
+}
+
+func CancelScheduledAnnouncement(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid announcement ID"})
+		return
+	}
+	announcement, err := database.GetScheduledAnnouncementByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Announcement not found"})
+		return
+	}
+	if announcement.CreatedBy != user.ID && user.Role != database.UserRole.Admin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only cancel your own announcements"})
+		return
+	}
+
+	if err := database.CancelScheduledAnnouncement(id); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Announcement cancelled successfully"})
+}
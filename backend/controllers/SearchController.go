@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"hermes/database"
+	"hermes/helpers"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 50
+	maxSearchQuery     = 200
+)
+
+var searchTypes = map[string]bool{
+	database.SearchType.Course:  true,
+	database.SearchType.Lecture: true,
+	database.SearchType.Section: true,
+	database.SearchType.Message: true,
+}
+
+// Search looks up courses, lectures, sections and the messages of the
+// tribunes the caller can read. Results of all types are ranked together.
+func Search(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Search query is required"})
+		return
+	}
+	if len(query) > maxSearchQuery {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Search query is too long"})
+		return
+	}
+
+	limit, _ := strconv.ParseInt(c.Query("limit"), 10, 64)
+	if limit <= 0 || limit > maxSearchLimit {
+		limit = defaultSearchLimit
+	}
+
+	scope := database.SearchScope{Types: map[string]bool{}}
+	if val := c.Query("type"); val != "" {
+		for _, kind := range strings.Split(val, ",") {
+			kind = strings.TrimSpace(kind)
+			if !searchTypes[kind] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown search type " + kind})
+				return
+			}
+			scope.Types[kind] = true
+		}
+	}
+
+	tribuneNames := map[primitive.ObjectID]string{}
+	if len(scope.Types) == 0 || scope.Types[database.SearchType.Message] {
+		var tribunes []database.Tribune
+		var err error
+		if user.Role == database.UserRole.Admin {
+			tribunes, err = database.GetAllTribunes()
+		} else {
+			tribunes, err = database.GetTribunesForUser(user.ID)
+			scope.Tribunes = []primitive.ObjectID{}
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tribunes"})
+			return
+		}
+		for _, tribune := range tribunes {
+			tribuneNames[tribune.ID] = tribune.Name
+			if scope.Tribunes != nil {
+				scope.Tribunes = append(scope.Tribunes, tribune.ID)
+			}
+		}
+	}
+
+	results, err := database.Search(query, scope, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Search failed"})
+		return
+	}
+
+	terms := helpers.SearchTerms(query)
+	for i := range results {
+		result := &results[i]
+		text := result.Text
+		if text == "" {
+			text = result.Title
+		}
+		result.Snippet = helpers.Highlight(text, terms)
+		if result.Type == database.SearchType.Message && result.Title == "" && result.Tribune != nil {
+			result.Title = tribuneNames[*result.Tribune]
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"query": query, "results": results})
+}
@@ -120,6 +120,7 @@ func EnrollUser(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	database.EmitWebhookEvent(database.WebhookEvent.EnrollmentCreated, gin.H{"user": userObjID, "section": sectionObjID})
 
 	c.JSON(http.StatusOK, gin.H{"message": "User enrolled successfully", "modified_count": result.ModifiedCount})
 }
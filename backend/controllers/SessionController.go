@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"hermes/database"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func GetSessions(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	currentID, _ := c.Get("sessionID")
+
+	sessions, err := database.GetActiveSessionsForUser(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve sessions"})
+		return
+	}
+
+	type sessionView struct {
+		database.Session
+		Current bool `json:"current"`
+	}
+	views := []sessionView{}
+	for _, session := range sessions {
+		views = append(views, sessionView{Session: session, Current: session.ID == currentID})
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": views})
+}
+
+func RevokeSession(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	objID, err := primitive.ObjectIDFromHex(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	if _, err := database.RevokeSession(objID, user.ID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
+}
+
+func RevokeOtherSessions(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	// API key requests have no session, so this signs out every session
+	currentID := primitive.NilObjectID
+	if val, ok := c.Get("sessionID"); ok {
+		currentID = val.(primitive.ObjectID)
+	}
+
+	result, err := database.RevokeOtherSessions(user.ID, currentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Other sessions revoked successfully", "revoked": result.ModifiedCount})
+}
@@ -0,0 +1,299 @@
+package controllers
+
+import (
+	"errors"
+	"hermes/database"
+	"hermes/helpers"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const maxSubmissionFiles = 10
+
+// loadAssignment resolves the assignment message named by the "id" query
+// parameter together with its tribune.
+func loadAssignment(c *gin.Context) (*database.Assignment, database.Tribune, bool) {
+	var tribune database.Tribune
+	assignmentID, err := primitive.ObjectIDFromHex(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignment ID"})
+		return nil, tribune, false
+	}
+	message, err := database.GetMessageByID(assignmentID)
+	if err != nil || message.Base().Deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Assignment not found"})
+		return nil, tribune, false
+	}
+	assignment, ok := message.(*database.Assignment)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Message is not an assignment"})
+		return nil, tribune, false
+	}
+	tribune, err = database.GetTribuneByID(assignment.Tribune)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tribune not found"})
+		return nil, tribune, false
+	}
+	return assignment, tribune, true
+}
+
+func SubmitAssignment(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	assignment, tribune, ok := loadAssignment(c)
+	if !ok {
+		return
+	}
+	if !tribune.IsMember(user.ID) || tribune.IsMaintainer(user.ID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot submit to this assignment"})
+		return
+	}
+
+	now := time.Now()
+	allowed, late := assignment.AcceptsSubmissionAt(now)
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "The deadline for this assignment has passed"})
+		return
+	}
+
+	if previous, err := database.GetSubmissionForUser(assignment.ID, user.ID); err == nil && previous.Graded {
+		c.JSON(http.StatusConflict, gin.H{"error": "Your submission has already been graded"})
+		return
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	text := strings.TrimSpace(c.PostForm("text"))
+	headers := form.File["files"]
+	if text == "" && len(headers) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A submission needs text or at least one file"})
+		return
+	}
+	if len(headers) > maxSubmissionFiles {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many files"})
+		return
+	}
+
+	files := []database.StoredFile{}
+	for _, header := range headers {
+		stored, err := database.UploadFile(database.SubmissionBucket, header)
+		if err != nil {
+			for _, file := range files {
+				database.DeleteFile(database.SubmissionBucket, file.FileID)
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		files = append(files, stored)
+	}
+
+	submission, replaced, err := database.SubmitAssignment(database.Submission{
+		Assignment:  assignment.ID,
+		Tribune:     tribune.ID,
+		User:        user.ID,
+		Text:        text,
+		Files:       files,
+		SubmittedAt: now,
+		Late:        late,
+	})
+	if err != nil {
+		for _, file := range files {
+			database.DeleteFile(database.SubmissionBucket, file.FileID)
+		}
+		if errors.Is(err, database.ErrSubmissionGraded) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Your submission has already been graded"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save submission"})
+		return
+	}
+	for _, file := range replaced {
+		if err := database.DeleteFile(database.SubmissionBucket, file.FileID); err != nil {
+			log.Printf("failed to delete replaced submission file %s: %v", file.FileID.Hex(), err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Submission saved successfully", "submission": submission})
+}
+
+func GetAssignmentSubmissions(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	assignment, tribune, ok := loadAssignment(c)
+	if !ok {
+		return
+	}
+	if !canModerateTribune(user, tribune) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not maintain this tribune"})
+		return
+	}
+
+	submissions, err := database.GetSubmissionsForAssignment(assignment.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve submissions"})
+		return
+	}
+	if submissions == nil {
+		submissions = []database.Submission{}
+	}
+	c.JSON(http.StatusOK, gin.H{"submissions": submissions})
+}
+
+func GetMySubmission(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	assignment, _, ok := loadAssignment(c)
+	if !ok {
+		return
+	}
+
+	submission, err := database.GetSubmissionForUser(assignment.ID, user.ID)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "You have not submitted this assignment"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve submission"})
+		return
+	}
+	c.JSON(http.StatusOK, submission)
+}
+
+func GradeSubmission(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	submissionID, err := primitive.ObjectIDFromHex(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid submission ID"})
+		return
+	}
+	var req struct {
+		Grade    *float64 `json:"grade" binding:"required"`
+		Feedback string   `json:"feedback"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	submission, err := database.GetSubmissionByID(submissionID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Submission not found"})
+		return
+	}
+	message, err := database.GetMessageByID(submission.Assignment)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Assignment not found"})
+		return
+	}
+	assignment, ok := message.(*database.Assignment)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Assignment not found"})
+		return
+	}
+	tribune, err := database.GetTribuneByID(submission.Tribune)
+	if err != nil || !canModerateTribune(user, tribune) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not maintain this tribune"})
+		return
+	}
+
+	graded, err := database.GradeSubmission(submissionID, assignment, *req.Grade, strings.TrimSpace(req.Feedback), user.ID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	helpers.SendNotification(submission.User, user.Name, "Your submission in %s has been graded", tribune.Name)
+	database.EmitWebhookEvent(database.WebhookEvent.GradePosted, gin.H{
+		"submission": graded.ID,
+		"assignment": graded.Assignment,
+		"tribune":    graded.Tribune,
+		"user":       graded.User,
+		"grade":      graded.Grade,
+		"rawGrade":   graded.RawGrade,
+		"late":       graded.Late,
+		"gradedBy":   graded.GradedBy,
+		"gradedAt":   graded.GradedAt,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Submission graded successfully", "submission": graded})
+}
+
+func DownloadSubmissionFile(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	submissionID, err := primitive.ObjectIDFromHex(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid submission ID"})
+		return
+	}
+	fileID, err := primitive.ObjectIDFromHex(c.Query("file"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file ID"})
+		return
+	}
+
+	submission, err := database.GetSubmissionByID(submissionID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Submission not found"})
+		return
+	}
+	if submission.User != user.ID {
+		tribune, err := database.GetTribuneByID(submission.Tribune)
+		if err != nil || !canModerateTribune(user, tribune) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You cannot access this submission"})
+			return
+		}
+	}
+
+	for _, file := range submission.Files {
+		if file.FileID != fileID {
+			continue
+		}
+		c.Header("Content-Type", file.ContentType)
+		c.Header("Content-Disposition", "attachment; filename=\""+strings.ReplaceAll(file.Filename, "\"", "")+"\"")
+		if err := database.DownloadFile(database.SubmissionBucket, fileID, c.Writer); err != nil {
+			log.Printf("failed to stream submission file %s: %v", fileID.Hex(), err)
+		}
+		return
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+}
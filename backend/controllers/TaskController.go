@@ -78,6 +78,17 @@ func UpdateTask(c *gin.Context) {
 		return
 	}
 
+	// due_date arrives as an RFC 3339 string and is stored as a date so
+	// reminders can find it, null clears it
+	if due, ok := updatedData["due_date"].(string); ok {
+		dueDate, err := time.Parse(time.RFC3339, due)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid due date"})
+			return
+		}
+		updatedData["due_date"] = primitive.NewDateTimeFromTime(dueDate)
+	}
+
 	result, err := database.UpdateTask(objID, updatedData)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update task"})
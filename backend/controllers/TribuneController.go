@@ -3,6 +3,7 @@ package controllers
 import (
 	"hermes/database"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -25,6 +26,9 @@ func CreateTribune(c *gin.Context) {
 	if newTribune.ID.IsZero() {
 		newTribune.ID = primitive.NewObjectID()
 	}
+	if !resolveTribuneLink(c, &newTribune) {
+		return
+	}
 	newTribune.Maintainers = append(newTribune.Maintainers, user.ID)
 	_, err := database.CreateTribune(newTribune)
 	if err != nil {
@@ -48,6 +52,10 @@ func GetTribune(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tribune"})
 		return
 	}
+	if !canReadTribune(c, tribune) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this tribune"})
+		return
+	}
 
 	c.JSON(http.StatusOK, tribune)
 }
@@ -67,12 +75,20 @@ func UpdateTribune(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Id format is not supported"})
 		return
 	}
-	var newTribune database.Tribune
+	var req struct {
+		database.Tribune
+		// Unlink detaches the tribune from its course or lecture, an empty
+		// CourseID and LectureID keep the current link.
+		Unlink bool
+		// AllowStudentPosts keeps its current value when it is left out.
+		AllowStudentPosts *bool
+	}
 	var oldTribune database.Tribune
-	if err := c.ShouldBindJSON(&newTribune); err != nil {
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	newTribune := req.Tribune
 	oldTribune, err = database.GetTribuneByID(objID)
 	validuser := false
 	for _, users := range oldTribune.Maintainers {
@@ -101,18 +117,47 @@ func UpdateTribune(c *gin.Context) {
 	if len(newTribune.Maintainers) == 0 {
 		newTribune.Maintainers = oldTribune.Maintainers
 	}
+	newTribune.AllowStudentPosts = oldTribune.AllowStudentPosts
+	if req.AllowStudentPosts != nil {
+		newTribune.AllowStudentPosts = *req.AllowStudentPosts
+	}
+	if req.Unlink {
+		newTribune.CourseID = primitive.NilObjectID
+		newTribune.LectureID = primitive.NilObjectID
+	} else if newTribune.CourseID.IsZero() && newTribune.LectureID.IsZero() {
+		newTribune.CourseID = oldTribune.CourseID
+		newTribune.LectureID = oldTribune.LectureID
+	} else if !resolveTribuneLink(c, &newTribune) {
+		return
+	}
+	relinked := newTribune.CourseID != oldTribune.CourseID || newTribune.LectureID != oldTribune.LectureID
+	newTribune.Members = oldTribune.Members
 
 	_, err = database.UpdateTribune(objID, newTribune)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update Tribune"})
 		return
 	}
+	if relinked {
+		if err := database.SyncTribuneMembers(objID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tribune members"})
+			return
+		}
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Tribune updated successfully", "id": oldTribune.ID.Hex()})
 }
 
 func GetAllTribunes(c *gin.Context) {
-	tribunes, err := database.GetAllTribunes()
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	tribunes, err := database.GetTribunesForUser(user.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Unable to fetch tribunes",
@@ -123,10 +168,125 @@ func GetAllTribunes(c *gin.Context) {
 	if tribunes == nil {
 		c.JSON(http.StatusOK, gin.H{
 			"tribunes": []interface{}{},
+			"unread":   gin.H{},
 		})
 		return
 	}
+
+	ids := make([]primitive.ObjectID, 0, len(tribunes))
+	for _, tribune := range tribunes {
+		ids = append(ids, tribune.ID)
+	}
+	counts, err := database.GetUnreadCounts(user.ID, ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Unable to count unread messages",
+		})
+		return
+	}
+	unread := gin.H{}
+	for _, id := range ids {
+		unread[id.Hex()] = counts[id]
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"tribunes": tribunes,
+		"unread":   unread,
 	})
 }
+
+func GetTribuneMessages(c *gin.Context) {
+	objID, err := primitive.ObjectIDFromHex(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tribune ID"})
+		return
+	}
+
+	before, after, limit, ok := pageCursors(c)
+	if !ok {
+		return
+	}
+
+	tribune, err := database.GetTribuneByID(objID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tribune not found"})
+		return
+	}
+	if !canReadTribune(c, tribune) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this tribune"})
+		return
+	}
+
+	page, err := database.GetTribuneMessages(objID, before, after, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve messages"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"messages": page.Messages,
+		"before":   page.Before.Hex(),
+		"after":    page.After.Hex(),
+		"hasMore":  page.HasMore,
+	})
+}
+
+// canReadTribune reports whether the authenticated user may see a tribune
+// and its messages.
+func canReadTribune(c *gin.Context, tribune database.Tribune) bool {
+	val, ok := c.Get("user")
+	if !ok {
+		return false
+	}
+	return canUserReadTribune(val.(database.User), tribune)
+}
+
+func canUserReadTribune(user database.User, tribune database.Tribune) bool {
+	return tribune.IsMember(user.ID) || user.Role == database.UserRole.Admin
+}
+
+// resolveTribuneLink checks the course or lecture a tribune is linked to. A
+// lecture link also sets the course of the lecture.
+func resolveTribuneLink(c *gin.Context, tribune *database.Tribune) bool {
+	tribune.Members = nil
+	if !tribune.LectureID.IsZero() {
+		lecture, err := database.GetLectureByID(tribune.LectureID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Linked lecture not found"})
+			return false
+		}
+		tribune.CourseID = lecture.Course
+		return true
+	}
+	if !tribune.CourseID.IsZero() {
+		if _, err := database.GetCourseByID(tribune.CourseID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Linked course not found"})
+			return false
+		}
+	}
+	return true
+}
+
+// pageCursors reads the before, after and limit query parameters used to
+// page through messages.
+func pageCursors(c *gin.Context) (before, after primitive.ObjectID, limit int64, ok bool) {
+	var err error
+	if val := c.Query("before"); val != "" {
+		if before, err = primitive.ObjectIDFromHex(val); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid before cursor"})
+			return
+		}
+	}
+	if val := c.Query("after"); val != "" {
+		if after, err = primitive.ObjectIDFromHex(val); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid after cursor"})
+			return
+		}
+	}
+	if !before.IsZero() && !after.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only one of before and after can be used"})
+		return
+	}
+	limit, _ = strconv.ParseInt(c.Query("limit"), 10, 64)
+	return before, after, limit, true
+}
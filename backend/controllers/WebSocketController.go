@@ -0,0 +1,291 @@
+package controllers
+
+import (
+	"encoding/json"
+	"hermes/database"
+	"hermes/helpers"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The WebSocket endpoint at /api/ws carries notifications and tribune chat
+// over one connection. Browsers first get a ticket from POST /api/ws/ticket
+// and connect to /api/ws?ticket=<ticket> within 30 seconds, the ticket works
+// once. Every frame is a JSON object with a "type".
+//
+// Client frames:
+//
+//	{"type": "subscribe", "tribune": "<id>"}    follow a tribune's messages
+//	{"type": "unsubscribe", "tribune": "<id>"}  stop following it
+//	{"type": "typing", "tribune": "<id>"}       tell followers you are typing
+//	{"type": "ping"}                            answered with a pong frame
+//
+// Server frames:
+//
+//	{"type": "notification", "data": {...}}                   same records as the SSE stream
+//	{"type": "tribune", "tribune": "<id>", "event": "...", "data": {...}}
+//	{"type": "subscribed" | "unsubscribed", "tribune": "<id>"}
+//	{"type": "pong"}
+//	{"type": "error", "error": "..."}
+//
+// Tribune events are message.created, message.edited, message.deleted,
+// poll.results and typing. The server also sends WebSocket pings and closes connections that
+// stop answering them. Clients that send frames faster than the rate limit
+// get an error frame and the frame is ignored.
+
+const (
+	wsWriteWait      = 10 * time.Second
+	wsPongWait       = 60 * time.Second
+	wsPingPeriod     = wsPongWait * 9 / 10
+	wsMaxFrameSize   = 4096
+	wsRateBurst      = 20
+	wsRateLeak       = 250 * time.Millisecond
+	wsMaxTribunes    = 50
+	wsOutgoingBuffer = 16
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// authentication is by bearer token, not cookies, so any origin the CORS
+	// policy accepts may connect
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+type wsRequest struct {
+	Type    string `json:"type"`
+	Tribune string `json:"tribune"`
+}
+
+type wsFrame struct {
+	Type    string      `json:"type"`
+	Tribune string      `json:"tribune,omitempty"`
+	Event   string      `json:"event,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// typingEvent is the data of a typing tribune event.
+type typingEvent struct {
+	User     primitive.ObjectID `json:"user"`
+	Username string             `json:"username"`
+}
+
+type wsClient struct {
+	conn          *websocket.Conn
+	user          database.User
+	out           chan wsFrame
+	notifications *helpers.Subscription
+	tribunes      *helpers.Subscription
+	joined        map[primitive.ObjectID]bool
+	limiter       *helpers.LeakyBucket
+}
+
+// CreateWebSocketTicket issues a short lived ticket to open the WebSocket
+// with, so the bearer token never appears in a URL.
+func CreateWebSocketTicket(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	var sessionID primitive.ObjectID
+	if val, ok := c.Get("sessionID"); ok {
+		sessionID = val.(primitive.ObjectID)
+	}
+
+	ticket, err := database.CreateWebSocketTicket(user.ID, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create ticket"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ticket": ticket, "expiresIn": int(database.WebSocketTicketTTL.Seconds())})
+}
+
+func WebSocketEndpoint(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// the upgrader has already written the error response
+		return
+	}
+
+	client := &wsClient{
+		conn:          conn,
+		user:          user,
+		out:           make(chan wsFrame, wsOutgoingBuffer),
+		notifications: helpers.Notifications.Subscribe(notificationChannels(user.ID)...),
+		tribunes:      helpers.TribuneStreams.Subscribe(),
+		joined:        map[primitive.ObjectID]bool{},
+		limiter:       helpers.InitLeakyBucket(wsRateBurst, wsRateLeak),
+	}
+	done := make(chan struct{})
+	go client.writeLoop(done)
+	client.readLoop()
+
+	close(done)
+	client.notifications.Close()
+	client.tribunes.Close()
+}
+
+// readLoop handles client frames until the connection fails. Only it changes
+// the joined tribunes.
+func (client *wsClient) readLoop() {
+	conn := client.conn
+	conn.SetReadLimit(wsMaxFrameSize)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if !client.limiter.Allow() {
+			client.send(wsFrame{Type: "error", Error: "Too many frames, slow down"})
+			continue
+		}
+		var req wsRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			client.send(wsFrame{Type: "error", Error: "Invalid frame"})
+			continue
+		}
+		client.handle(req)
+	}
+}
+
+func (client *wsClient) handle(req wsRequest) {
+	switch req.Type {
+	case "ping":
+		client.send(wsFrame{Type: "pong"})
+	case "subscribe":
+		tribune, ok := client.loadTribune(req.Tribune)
+		if !ok {
+			return
+		}
+		if !canUserReadTribune(client.user, tribune) {
+			client.send(wsFrame{Type: "error", Tribune: req.Tribune, Error: "You are not a member of this tribune"})
+			return
+		}
+		if !client.joined[tribune.ID] && len(client.joined) >= wsMaxTribunes {
+			client.send(wsFrame{Type: "error", Tribune: req.Tribune, Error: "Too many tribunes followed"})
+			return
+		}
+		client.joined[tribune.ID] = true
+		client.tribunes.SetChannels(client.joinedTribunes()...)
+		client.send(wsFrame{Type: "subscribed", Tribune: req.Tribune})
+	case "unsubscribe":
+		id, err := primitive.ObjectIDFromHex(req.Tribune)
+		if err != nil {
+			client.send(wsFrame{Type: "error", Error: "Invalid tribune ID"})
+			return
+		}
+		delete(client.joined, id)
+		client.tribunes.SetChannels(client.joinedTribunes()...)
+		client.send(wsFrame{Type: "unsubscribed", Tribune: req.Tribune})
+	case "typing":
+		id, err := primitive.ObjectIDFromHex(req.Tribune)
+		if err != nil || !client.joined[id] {
+			client.send(wsFrame{Type: "error", Tribune: req.Tribune, Error: "Subscribe to the tribune first"})
+			return
+		}
+		if _, muted := database.GetActiveMute(id, client.user.ID); muted {
+			return
+		}
+		helpers.SendTribuneEvent(id, "typing", typingEvent{User: client.user.ID, Username: client.user.Username})
+	default:
+		client.send(wsFrame{Type: "error", Error: "Unknown frame type"})
+	}
+}
+
+func (client *wsClient) loadTribune(hex string) (database.Tribune, bool) {
+	id, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		client.send(wsFrame{Type: "error", Error: "Invalid tribune ID"})
+		return database.Tribune{}, false
+	}
+	tribune, err := database.GetTribuneByID(id)
+	if err != nil {
+		client.send(wsFrame{Type: "error", Tribune: hex, Error: "Tribune not found"})
+		return tribune, false
+	}
+	return tribune, true
+}
+
+func (client *wsClient) joinedTribunes() []primitive.ObjectID {
+	ids := make([]primitive.ObjectID, 0, len(client.joined))
+	for id := range client.joined {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// send queues a reply for the writer. Replies are dropped when the client is
+// not reading them.
+func (client *wsClient) send(frame wsFrame) {
+	select {
+	case client.out <- frame:
+	default:
+	}
+}
+
+// writeLoop is the only writer of the connection. It closes the connection
+// when a write fails or a subscription is dropped, which ends readLoop.
+func (client *wsClient) writeLoop(done <-chan struct{}) {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer func() {
+		ticker.Stop()
+		client.conn.Close()
+	}()
+
+	for {
+		var frame wsFrame
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			client.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := client.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+			continue
+		case frame = <-client.out:
+		case notification, ok := <-client.notifications.Events():
+			if !ok {
+				return
+			}
+			if notification.Event == helpers.SubscriptionsChangedEvent && notification.ObjectID == client.user.ID {
+				client.notifications.SetChannels(notificationChannels(client.user.ID)...)
+			}
+			frame = wsFrame{Type: "notification", Data: notification}
+		case event, ok := <-client.tribunes.Events():
+			if !ok {
+				return
+			}
+			if typing, isTyping := event.Data.(typingEvent); isTyping && typing.User == client.user.ID {
+				continue
+			}
+			frame = wsFrame{Type: "tribune", Tribune: event.ObjectID.Hex(), Event: event.Event, Data: event.Data}
+		}
+
+		client.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		if err := client.conn.WriteJSON(frame); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"hermes/database"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type webhookRequest struct {
+	Name   string   `json:"name" binding:"required"`
+	URL    string   `json:"url" binding:"required"`
+	Events []string `json:"events"`
+	Active *bool    `json:"active"`
+}
+
+func (req webhookRequest) webhook() database.Webhook {
+	active := true
+	if req.Active != nil {
+		active = *req.Active
+	}
+	return database.Webhook{Name: req.Name, URL: req.URL, Events: req.Events, Active: active}
+}
+
+func loadWebhook(c *gin.Context) (database.Webhook, bool) {
+	id, err := primitive.ObjectIDFromHex(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return database.Webhook{}, false
+	}
+	hook, err := database.GetWebhookByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return hook, false
+	}
+	return hook, true
+}
+
+func GetWebhooks(c *gin.Context) {
+	hooks, err := database.GetWebhooks(bson.M{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get webhooks"})
+		return
+	}
+	c.JSON(http.StatusOK, hooks)
+}
+
+// CreateWebhook registers a webhook. The signing secret is only returned
+// here.
+func CreateWebhook(c *gin.Context) {
+	var user database.User
+	if val, ok := c.Get("user"); ok {
+		user = val.(database.User)
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hook := req.webhook()
+	hook.CreatedBy = user.ID
+	hook, err := database.CreateWebhook(hook)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook created successfully", "id": hook.ID.Hex(), "secret": hook.Secret})
+}
+
+func UpdateWebhook(c *gin.Context) {
+	hook, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Active == nil {
+		req.Active = &hook.Active
+	}
+
+	if _, err := database.UpdateWebhook(hook.ID, req.webhook()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook updated successfully"})
+}
+
+func DeleteWebhook(c *gin.Context) {
+	hook, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+
+	if _, err := database.DeleteWebhook(hook.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+// TestWebhook sends a ping event so the receiver can be checked.
+func TestWebhook(c *gin.Context) {
+	hook, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+
+	delivery, err := database.QueueWebhookPing(hook)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue ping"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Ping queued successfully", "delivery": delivery.ID.Hex()})
+}
+
+func GetWebhookDeliveries(c *gin.Context) {
+	hook, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.ParseInt(c.Query("limit"), 10, 64)
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	deliveries, err := database.GetWebhookDeliveries(hook.ID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get deliveries"})
+		return
+	}
+	c.JSON(http.StatusOK, deliveries)
+}
+
+func ReplayWebhookDelivery(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery ID"})
+		return
+	}
+	original, err := database.GetWebhookDeliveryByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+		return
+	}
+	if _, err := database.GetWebhookByID(original.Webhook); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+
+	delivery, err := database.ReplayWebhookDelivery(original)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to replay delivery"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Delivery replayed successfully", "delivery": delivery.ID.Hex()})
+}
@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// APIKey lets scripts authenticate as their owner without a password. Only
+// the SHA-256 hash of the key is stored, the plaintext is shown once.
+type APIKey struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	User       primitive.ObjectID `bson:"user" json:"user"`
+	Name       string             `bson:"name" json:"name"`
+	Prefix     string             `bson:"prefix" json:"prefix"`
+	Hash       string             `bson:"hash" json:"-"`
+	Scopes     []string           `bson:"scopes" json:"scopes"`
+	CreatedAt  time.Time          `bson:"createdAt" json:"createdAt"`
+	ExpiresAt  time.Time          `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+	LastUsedAt time.Time          `bson:"lastUsedAt,omitempty" json:"lastUsedAt,omitempty"`
+	RevokedAt  time.Time          `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+}
+
+// APIKeyScopes lists the resources a key can be granted. Each resource is
+// granted as "<resource>:read" for GET requests or "<resource>:write" for
+// everything else, and "*" grants full access.
+var APIKeyScopes = []string{"users", "tribunes", "tasks", "lectures", "courses", "sections", "notification", "search"}
+
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func IsValidAPIKeyScope(scope string) bool {
+	if scope == "*" {
+		return true
+	}
+	for _, resource := range APIKeyScopes {
+		if scope == resource+":read" || scope == resource+":write" {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the key may perform a read or write on resource.
+// A write scope implies read access to the same resource.
+func (k APIKey) HasScope(resource string, write bool) bool {
+	for _, scope := range k.Scopes {
+		if scope == "*" || scope == resource+":write" {
+			return true
+		}
+		if !write && scope == resource+":read" {
+			return true
+		}
+	}
+	return false
+}
+
+func (k APIKey) IsActive() bool {
+	if !k.RevokedAt.IsZero() {
+		return false
+	}
+	return k.ExpiresAt.IsZero() || time.Now().Before(k.ExpiresAt)
+}
+
+func CreateAPIKey(key APIKey) (*mongo.InsertOneResult, error) {
+	for _, scope := range key.Scopes {
+		if !IsValidAPIKeyScope(scope) {
+			return nil, fmt.Errorf("invalid scope %q", scope)
+		}
+	}
+	if len(key.Scopes) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+
+	collection := GetCollection("apikeys")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return collection.InsertOne(ctx, key)
+}
+
+func GetAPIKeyByHash(hash string) (APIKey, error) {
+	var key APIKey
+	collection := GetCollection("apikeys")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := collection.FindOne(ctx, bson.M{"hash": hash}).Decode(&key)
+	return key, err
+}
+
+func GetAPIKeysForUser(userID primitive.ObjectID) ([]APIKey, error) {
+	var keys []APIKey
+	collection := GetCollection("apikeys")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"createdAt": -1})
+	cursor, err := collection.Find(ctx, bson.M{"user": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var key APIKey
+		if err := cursor.Decode(&key); err != nil {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func TouchAPIKey(id primitive.ObjectID) (*mongo.UpdateResult, error) {
+	collection := GetCollection("apikeys")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return collection.UpdateByID(ctx, id, bson.M{"$set": bson.M{"lastUsedAt": time.Now()}})
+}
+
+func RevokeAPIKey(id primitive.ObjectID, userID primitive.ObjectID) (*mongo.UpdateResult, error) {
+	collection := GetCollection("apikeys")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": id, "user": userID, "revokedAt": bson.M{"$exists": false}}
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"revokedAt": time.Now()}})
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, fmt.Errorf("api key not found")
+	}
+	return result, nil
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AuditActions struct {
+	ImpersonationStart string
+	ImpersonationStop  string
+	ImpersonatedWrite  string
+
+	ModerationHide       string
+	ModerationUnhide     string
+	ModerationDelete     string
+	ModerationWarn       string
+	ModerationMute       string
+	ModerationUnmute     string
+	ModerationDismiss    string
+	ModerationFilterAdd  string
+	ModerationFilterDrop string
+}
+
+var AuditAction = AuditActions{
+	ImpersonationStart: "impersonation.start",
+	ImpersonationStop:  "impersonation.stop",
+	ImpersonatedWrite:  "impersonation.write",
+
+	ModerationHide:       "moderation.hide",
+	ModerationUnhide:     "moderation.unhide",
+	ModerationDelete:     "moderation.delete",
+	ModerationWarn:       "moderation.warn",
+	ModerationMute:       "moderation.mute",
+	ModerationUnmute:     "moderation.unmute",
+	ModerationDismiss:    "moderation.dismiss",
+	ModerationFilterAdd:  "moderation.filter.add",
+	ModerationFilterDrop: "moderation.filter.remove",
+}
+
+// AuditEvent is an append-only record of a privileged action. Actor is the
+// real user performing it and Subject the user it was performed on behalf of.
+type AuditEvent struct {
+	ID      primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Action  string             `bson:"action" json:"action"`
+	Actor   primitive.ObjectID `bson:"actor" json:"actor"`
+	Subject primitive.ObjectID `bson:"subject,omitempty" json:"subject,omitempty"`
+	Session primitive.ObjectID `bson:"session,omitempty" json:"session,omitempty"`
+	Method  string             `bson:"method,omitempty" json:"method,omitempty"`
+	Path    string             `bson:"path,omitempty" json:"path,omitempty"`
+	Status  int                `bson:"status,omitempty" json:"status,omitempty"`
+	IP      string             `bson:"ip,omitempty" json:"ip,omitempty"`
+	Details string             `bson:"details,omitempty" json:"details,omitempty"`
+	// Tribune and Target locate moderation actions, Target being the
+	// message, report or filter acted on.
+	Tribune primitive.ObjectID `bson:"tribune,omitempty" json:"tribune,omitempty"`
+	Target  primitive.ObjectID `bson:"target,omitempty" json:"target,omitempty"`
+	Time    time.Time          `bson:"time" json:"time"`
+}
+
+func CreateAuditEvent(event AuditEvent) (*mongo.InsertOneResult, error) {
+	if event.ID.IsZero() {
+		event.ID = primitive.NewObjectID()
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	collection := GetCollection("audit")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return collection.InsertOne(ctx, event)
+}
+
+// GetAuditEvents returns the newest events matching filter, at most limit.
+func GetAuditEvents(filter bson.M, limit int64) ([]AuditEvent, error) {
+	var events []AuditEvent
+	collection := GetCollection("audit")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"time": -1}).SetLimit(limit)
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var event AuditEvent
+		if err := cursor.Decode(&event); err != nil {
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
@@ -3,6 +3,7 @@ package database
 import (
 	"context"
 	"fmt"
+	"hermes/helpers"
 	"log"
 	"os"
 	"time"
@@ -37,6 +38,18 @@ func ConnectDB() {
 		log.Print(err)
 	} else {
 		InitIndexes()
+		RunMigrations()
+		sender := helpers.NewSenderFromEnv()
+		helpers.SetNotificationStore(notificationStore{emails: sender != nil})
+		StartNotificationCleanup(6 * time.Hour)
+		if sender != nil {
+			StartEmailDelivery(sender, time.Minute)
+		} else {
+			log.Println("SMTP_HOST is not set, notification emails are disabled")
+		}
+		StartWebhookDelivery(30 * time.Second)
+		StartAnnouncementScheduler(30 * time.Second)
+		StartReminders(time.Minute)
 		log.Println("Connected to MongoDB...")
 	}
 }
@@ -45,6 +58,28 @@ func InitIndexes() {
 	usercollection := GetCollection("users")
 	tribunecollection := GetCollection("tribune")
 	coursecollection := GetCollection("courses")
+	lecturecollection := GetCollection("lecture")
+	sectioncollection := GetCollection("section")
+	oidcstatecollection := GetCollection("oidcstate")
+	wsticketcollection := GetCollection("wstickets")
+	apikeycollection := GetCollection("apikeys")
+	sessioncollection := GetCollection("sessions")
+	auditcollection := GetCollection("audit")
+	messagecollection := GetCollection("messages")
+	submissioncollection := GetCollection("submissions")
+	reportcollection := GetCollection("reports")
+	mutecollection := GetCollection("mutes")
+	wordfiltercollection := GetCollection("wordfilters")
+	readstatecollection := GetCollection("readstates")
+	quizattemptcollection := GetCollection("quizattempts")
+	notificationcollection := GetCollection("notifications")
+	notificationreadcollection := GetCollection("notificationreads")
+	notificationchannelcollection := GetCollection("notificationchannels")
+	emaildeliverycollection := GetCollection("emaildeliveries")
+	webhookdeliverycollection := GetCollection("webhookdeliveries")
+	scheduledannouncementcollection := GetCollection("scheduledannouncements")
+	remindercollection := GetCollection("reminders")
+	taskcollection := GetCollection("task")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -60,27 +95,293 @@ func InitIndexes() {
 		Keys:    bson.M{"name": 1},
 		Options: options.Index().SetUnique(true),
 	}
+	tribuneMemberIndexModel := mongo.IndexModel{
+		Keys: bson.M{"members": 1},
+	}
+	tribuneMaintainerIndexModel := mongo.IndexModel{
+		Keys: bson.M{"maintainers": 1},
+	}
 	courseNameIndexModel := mongo.IndexModel{
 		Keys:    bson.M{"name": 1},
 		Options: options.Index().SetUnique(true),
   }
+	oidcSubjectIndexModel := mongo.IndexModel{
+		Keys:    bson.M{"oidcSubject": 1},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"oidcSubject": bson.M{"$exists": true}}),
+	}
+	oidcStateIndexModel := mongo.IndexModel{
+		Keys:    bson.M{"state": 1},
+		Options: options.Index().SetUnique(true),
+	}
+	oidcStateExpiryIndexModel := mongo.IndexModel{
+		Keys:    bson.M{"expiresAt": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+	wsTicketIndexModel := mongo.IndexModel{
+		Keys:    bson.M{"hash": 1},
+		Options: options.Index().SetUnique(true),
+	}
+	wsTicketExpiryIndexModel := mongo.IndexModel{
+		Keys:    bson.M{"expiresAt": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+	apiKeyHashIndexModel := mongo.IndexModel{
+		Keys:    bson.M{"hash": 1},
+		Options: options.Index().SetUnique(true),
+	}
+	apiKeyUserIndexModel := mongo.IndexModel{
+		Keys: bson.M{"user": 1},
+	}
+	sessionUserIndexModel := mongo.IndexModel{
+		Keys: bson.M{"user": 1},
+	}
+	sessionExpiryIndexModel := mongo.IndexModel{
+		Keys:    bson.M{"expiresAt": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+	auditActorIndexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: "actor", Value: 1}, {Key: "time", Value: -1}},
+	}
+	auditSubjectIndexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: "subject", Value: 1}, {Key: "time", Value: -1}},
+	}
+	auditTribuneIndexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: "tribune", Value: 1}, {Key: "time", Value: -1}},
+	}
+	messageTribuneIndexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: "tribune", Value: 1}, {Key: "_id", Value: -1}},
+	}
+	messageDateIndexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: "tribune", Value: 1}, {Key: "date", Value: -1}},
+	}
+	messageThreadIndexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: "replyTo", Value: 1}, {Key: "_id", Value: 1}},
+	}
+	messageDeadlineIndexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "kind", Value: 1}, {Key: "deadline", Value: 1}},
+		Options: options.Index().SetPartialFilterExpression(bson.M{"deadline": bson.M{"$exists": true}}),
+	}
+	// text indexes backing /api/search, names and codes weigh more than
+	// descriptions
+	courseTextIndexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "name", Value: "text"}, {Key: "code", Value: "text"}, {Key: "description", Value: "text"}},
+		Options: options.Index().SetWeights(bson.M{"name": 10, "code": 10, "description": 1}),
+	}
+	lectureTextIndexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "name", Value: "text"}, {Key: "code", Value: "text"}, {Key: "description", Value: "text"}},
+		Options: options.Index().SetWeights(bson.M{"name": 10, "code": 10, "description": 1}),
+	}
+	sectionTextIndexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "name", Value: "text"}, {Key: "code", Value: "text"}, {Key: "description", Value: "text"}},
+		Options: options.Index().SetWeights(bson.M{"name": 10, "code": 10, "description": 1}),
+	}
+	messageTextIndexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "title", Value: "text"}, {Key: "content", Value: "text"}},
+		Options: options.Index().SetWeights(bson.M{"title": 5, "content": 1}),
+	}
+	submissionIndexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "assignment", Value: 1}, {Key: "user", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	// a user has at most one open report per message
+	reportUniqueIndexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "message", Value: 1}, {Key: "reporter", Value: 1}},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"status": ReportStatus.Open}),
+	}
+	reportQueueIndexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}, {Key: "tribune", Value: 1}, {Key: "createdAt", Value: 1}},
+	}
+	muteIndexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "tribune", Value: 1}, {Key: "user", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	muteExpiryIndexModel := mongo.IndexModel{
+		Keys:    bson.M{"until": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+	wordFilterIndexModel := mongo.IndexModel{
+		Keys: bson.M{"tribune": 1},
+	}
+	readStateIndexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "user", Value: 1}, {Key: "tribune", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	quizAttemptIndexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "quiz", Value: 1}, {Key: "user", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	quizAttemptTribuneIndexModel := mongo.IndexModel{
+		Keys: bson.M{"tribune": 1},
+	}
+	notificationChannelIndexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: "channel", Value: 1}, {Key: "_id", Value: -1}},
+	}
+	notificationSeqIndexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: "channel", Value: 1}, {Key: "seq", Value: 1}},
+	}
+	notificationEmailIndexModel := mongo.IndexModel{
+		Keys:    bson.M{"emailPending": 1},
+		Options: options.Index().SetPartialFilterExpression(bson.M{"emailPending": true}),
+	}
+	notificationReadIndexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "user", Value: 1}, {Key: "notification", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	notificationChannelNameIndexModel := mongo.IndexModel{
+		Keys:    bson.M{"name": 1},
+		Options: options.Index().SetUnique(true),
+	}
+	notificationChannelRulesIndexModels := []mongo.IndexModel{
+		{Keys: bson.M{"roles": 1}},
+		{Keys: bson.M{"courses": 1}},
+	}
+	emailDeliveryIndexModels := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "sendAfter", Value: 1}}},
+		{Keys: bson.D{{Key: "user", Value: 1}, {Key: "_id", Value: -1}}},
+	}
+	scheduledAnnouncementIndexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}, {Key: "sendAt", Value: 1}},
+	}
+	reminderIndexModels := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "source", Value: 1}, {Key: "due", Value: 1}, {Key: "offset", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.M{"expiresAt": 1},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}
+	taskDueDateIndexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: "is_done", Value: 1}, {Key: "due_date", Value: 1}},
+	}
+	webhookDeliveryIndexModels := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "nextAttempt", Value: 1}}},
+		{Keys: bson.D{{Key: "webhook", Value: 1}, {Key: "_id", Value: -1}}},
+	}
 
-	_, err := usercollection.Indexes().CreateMany(ctx, []mongo.IndexModel{emailindexModel, usernameindexModel})
+	_, err := usercollection.Indexes().CreateMany(ctx, []mongo.IndexModel{emailindexModel, usernameindexModel, oidcSubjectIndexModel})
 	if err != nil {
 		log.Fatal(err)
 	}
-	_, err = tribunecollection.Indexes().CreateOne(ctx, tribunenameindexModel)
+	_, err = tribunecollection.Indexes().CreateMany(ctx, []mongo.IndexModel{tribunenameindexModel, tribuneMemberIndexModel, tribuneMaintainerIndexModel})
 	if err != nil {
 		log.Fatal(err)
 	}
-	_, err = coursecollection.Indexes().CreateOne(ctx, courseNameIndexModel) // Create unique index for course name
+	_, err = coursecollection.Indexes().CreateMany(ctx, []mongo.IndexModel{courseNameIndexModel, courseTextIndexModel}) // Create unique index for course name
 	if err != nil {
 		 log.Fatal(err)
 	}
+	_, err = lecturecollection.Indexes().CreateOne(ctx, lectureTextIndexModel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = sectioncollection.Indexes().CreateOne(ctx, sectionTextIndexModel)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = oidcstatecollection.Indexes().CreateMany(ctx, []mongo.IndexModel{oidcStateIndexModel, oidcStateExpiryIndexModel})
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = wsticketcollection.Indexes().CreateMany(ctx, []mongo.IndexModel{wsTicketIndexModel, wsTicketExpiryIndexModel})
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = apikeycollection.Indexes().CreateMany(ctx, []mongo.IndexModel{apiKeyHashIndexModel, apiKeyUserIndexModel})
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = sessioncollection.Indexes().CreateMany(ctx, []mongo.IndexModel{sessionUserIndexModel, sessionExpiryIndexModel})
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = auditcollection.Indexes().CreateMany(ctx, []mongo.IndexModel{auditActorIndexModel, auditSubjectIndexModel, auditTribuneIndexModel})
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = messagecollection.Indexes().CreateMany(ctx, []mongo.IndexModel{messageTribuneIndexModel, messageDateIndexModel, messageThreadIndexModel, messageDeadlineIndexModel, messageTextIndexModel})
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = submissioncollection.Indexes().CreateOne(ctx, submissionIndexModel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = reportcollection.Indexes().CreateMany(ctx, []mongo.IndexModel{reportUniqueIndexModel, reportQueueIndexModel})
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = mutecollection.Indexes().CreateMany(ctx, []mongo.IndexModel{muteIndexModel, muteExpiryIndexModel})
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = wordfiltercollection.Indexes().CreateOne(ctx, wordFilterIndexModel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = readstatecollection.Indexes().CreateOne(ctx, readStateIndexModel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = quizattemptcollection.Indexes().CreateMany(ctx, []mongo.IndexModel{quizAttemptIndexModel, quizAttemptTribuneIndexModel})
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = notificationcollection.Indexes().CreateMany(ctx, []mongo.IndexModel{notificationChannelIndexModel, notificationSeqIndexModel, notificationEmailIndexModel})
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = notificationreadcollection.Indexes().CreateOne(ctx, notificationReadIndexModel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = notificationchannelcollection.Indexes().CreateMany(ctx, append(notificationChannelRulesIndexModels, notificationChannelNameIndexModel))
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = emaildeliverycollection.Indexes().CreateMany(ctx, emailDeliveryIndexModels)
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = webhookdeliverycollection.Indexes().CreateMany(ctx, webhookDeliveryIndexModels)
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = scheduledannouncementcollection.Indexes().CreateOne(ctx, scheduledAnnouncementIndexModel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = remindercollection.Indexes().CreateMany(ctx, reminderIndexModels)
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = taskcollection.Indexes().CreateOne(ctx, taskDueDateIndexModel)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	log.Println("Unique indexes created")
 }
 
+// RunMigrations brings documents written by older versions up to date. Each
+// migration must be safe to run on every start.
+func RunMigrations() {
+	moved, err := MigrateEmbeddedMessages()
+	if err != nil {
+		log.Printf("Failed to migrate tribune messages: %v", err)
+	} else if moved > 0 {
+		log.Printf("Moved %d tribune messages into the messages collection", moved)
+	}
+	if _, err := SyncLinkedTribuneMembers(); err != nil {
+		log.Printf("Failed to sync tribune members: %v", err)
+	}
+	if err := SeedNotificationChannels(); err != nil {
+		log.Printf("Failed to create notification channels: %v", err)
+	}
+}
+
 func Ping() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
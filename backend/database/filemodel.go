@@ -0,0 +1,85 @@
+package database
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const maxUploadSize = 25 * 1024 * 1024
+
+// StoredFile describes a file kept in GridFS.
+type StoredFile struct {
+	FileID      primitive.ObjectID `bson:"fileID"`
+	Filename    string             `bson:"filename"`
+	ContentType string             `bson:"contentType"`
+	Size        int64              `bson:"size"`
+}
+
+func getBucket(name string) (*gridfs.Bucket, error) {
+	db := Client.Database(os.Getenv("MONGO_DATABASE"))
+	return gridfs.NewBucket(db, options.GridFSBucket().SetName(name))
+}
+
+// UploadFile stores an uploaded file in the named GridFS bucket.
+func UploadFile(bucketName string, file *multipart.FileHeader) (StoredFile, error) {
+	var stored StoredFile
+	if file.Size > maxUploadSize {
+		return stored, fmt.Errorf("file too big")
+	}
+	src, err := file.Open()
+	if err != nil {
+		return stored, err
+	}
+	defer src.Close()
+
+	bucket, err := getBucket(bucketName)
+	if err != nil {
+		return stored, err
+	}
+	bucket.SetWriteDeadline(time.Now().Add(60 * time.Second))
+
+	contentType := file.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	opts := options.GridFSUpload().SetMetadata(bson.M{"contentType": contentType})
+	id, err := bucket.UploadFromStream(file.Filename, io.LimitReader(src, maxUploadSize), opts)
+	if err != nil {
+		return stored, fmt.Errorf("failed to store file: %v", err)
+	}
+
+	stored = StoredFile{
+		FileID:      id,
+		Filename:    file.Filename,
+		ContentType: contentType,
+		Size:        file.Size,
+	}
+	return stored, nil
+}
+
+// DownloadFile copies a stored file to w.
+func DownloadFile(bucketName string, id primitive.ObjectID, w io.Writer) error {
+	bucket, err := getBucket(bucketName)
+	if err != nil {
+		return err
+	}
+	bucket.SetReadDeadline(time.Now().Add(60 * time.Second))
+	_, err = bucket.DownloadToStream(id, w)
+	return err
+}
+
+func DeleteFile(bucketName string, id primitive.ObjectID) error {
+	bucket, err := getBucket(bucketName)
+	if err != nil {
+		return err
+	}
+	return bucket.Delete(id)
+}
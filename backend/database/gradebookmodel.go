@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GradebookItem is a graded piece of work in a tribune: an assignment or a
+// quiz.
+type GradebookItem struct {
+	ID       primitive.ObjectID `json:"id"`
+	Kind     string             `json:"kind"`
+	Title    string             `json:"title"`
+	MaxScore float64            `json:"maxScore"`
+}
+
+// GradebookRow holds a student's scores keyed by item id. Items without a
+// score yet are left out.
+type GradebookRow struct {
+	User   primitive.ObjectID `json:"user"`
+	Scores map[string]float64 `json:"scores"`
+	Total  float64            `json:"total"`
+}
+
+type Gradebook struct {
+	Tribune  primitive.ObjectID `json:"tribune"`
+	Items    []GradebookItem    `json:"items"`
+	Rows     []GradebookRow     `json:"rows"`
+	MaxTotal float64            `json:"maxTotal"`
+}
+
+// GetGradebook collects assignment grades and quiz scores of a tribune for
+// the given students.
+func GetGradebook(tribuneID primitive.ObjectID, students []primitive.ObjectID) (Gradebook, error) {
+	gradebook := Gradebook{Tribune: tribuneID, Items: []GradebookItem{}, Rows: []GradebookRow{}}
+
+	collection := GetCollection("messages")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"tribune": tribuneID,
+		"kind":    bson.M{"$in": []string{MessageKind.Assignment, MessageKind.Quiz}},
+		"deleted": bson.M{"$ne": true},
+	}
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return gradebook, err
+	}
+	messages, err := decodeMessages(ctx, cursor)
+	cursor.Close(ctx)
+	if err != nil {
+		return gradebook, err
+	}
+
+	for _, message := range messages {
+		item := GradebookItem{ID: message.GetID(), Kind: message.GetKind(), Title: gradebookTitle(message.GetContent())}
+		switch m := message.(type) {
+		case *Assignment:
+			item.MaxScore = m.MaxGrade
+		case *Quiz:
+			item.MaxScore = m.MaxScore()
+		}
+		gradebook.Items = append(gradebook.Items, item)
+		gradebook.MaxTotal += item.MaxScore
+	}
+
+	items := map[primitive.ObjectID]bool{}
+	for _, item := range gradebook.Items {
+		items[item.ID] = true
+	}
+	rows := map[primitive.ObjectID]*GradebookRow{}
+	for _, student := range students {
+		gradebook.Rows = append(gradebook.Rows, GradebookRow{User: student, Scores: map[string]float64{}})
+	}
+	for i := range gradebook.Rows {
+		rows[gradebook.Rows[i].User] = &gradebook.Rows[i]
+	}
+	record := func(user primitive.ObjectID, item primitive.ObjectID, score float64) {
+		if row, ok := rows[user]; ok && items[item] {
+			row.Scores[item.Hex()] = score
+			row.Total += score
+		}
+	}
+
+	submissions, err := GetGradedSubmissionsForTribune(tribuneID)
+	if err != nil {
+		return gradebook, err
+	}
+	for _, submission := range submissions {
+		record(submission.User, submission.Assignment, submission.Grade)
+	}
+	attempts, err := GetQuizAttempts(bson.M{"tribune": tribuneID})
+	if err != nil {
+		return gradebook, err
+	}
+	for _, attempt := range attempts {
+		record(attempt.User, attempt.Quiz, attempt.Score)
+	}
+	return gradebook, nil
+}
+
+func gradebookTitle(content string) string {
+	runes := []rune(content)
+	if len(runes) > 60 {
+		return string(runes[:60]) + "..."
+	}
+	return content
+}
@@ -101,6 +101,12 @@ func AssignLectureToUser(userid primitive.ObjectID, id primitive.ObjectID) (*mon
 	}
 
 	EnrollUserInSection(userid, lecture.Course)
+	if err := AddUserToLinkedTribunes(userid, lecture); err != nil {
+		log.Printf("failed to add user to tribunes of lecture %s: %v", lecture.ID.Hex(), err)
+	}
+	if err := SubscribeToCourseChannels(userid, lecture.Course); err != nil {
+		log.Printf("failed to subscribe user to channels of course %s: %v", lecture.Course.Hex(), err)
+	}
 
 	return result, nil
 }
@@ -136,6 +142,12 @@ func DeleteLectureFromUser(userid primitive.ObjectID, id primitive.ObjectID) (*m
 		return nil, fmt.Errorf("failed to assign user to lecture: no document modified")
 	}
 	DecrementLectureSlotsTaken(id, 1)
+	if err := RemoveUserFromLinkedTribunes(userid, lecture); err != nil {
+		log.Printf("failed to remove user from tribunes of lecture %s: %v", lecture.ID.Hex(), err)
+	}
+	if err := UnsubscribeFromCourseChannels(userid, lecture.Course); err != nil {
+		log.Printf("failed to unsubscribe user from channels of course %s: %v", lecture.Course.Hex(), err)
+	}
 
 	return result, nil
 }
@@ -167,6 +179,12 @@ func RemoveUserFromLectureAndSection(userID primitive.ObjectID, lectureID primit
 	if err != nil {
 		return fmt.Errorf("failed to remove user from section: %v", err)
 	}
+	if err := RemoveUserFromLinkedTribunes(userID, lecture); err != nil {
+		return fmt.Errorf("failed to remove user from tribunes: %v", err)
+	}
+	if err := UnsubscribeFromCourseChannels(userID, courseID); err != nil {
+		return fmt.Errorf("failed to unsubscribe user from course channels: %v", err)
+	}
 
 	return nil
 }
@@ -322,3 +340,41 @@ func GetAllLecturesForUser(userid primitive.ObjectID) ([]Lecture, error) {
 
 	return lectures, nil
 }
+
+func GetLecturesForCourse(courseID primitive.ObjectID) ([]Lecture, error) {
+	var lectures []Lecture
+	collection := GetCollection("lecture")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := collection.Find(ctx, bson.M{"course": courseID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var lecture Lecture
+		if err := cursor.Decode(&lecture); err != nil {
+			continue
+		} else {
+			lectures = append(lectures, lecture)
+		}
+	}
+
+	return lectures, nil
+}
+
+// IsUserEnrolledInCourse reports whether the user is enrolled in any lecture
+// of the course.
+func IsUserEnrolledInCourse(userID primitive.ObjectID, courseID primitive.ObjectID) (bool, error) {
+	collection := GetCollection("lecture")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	count, err := collection.CountDocuments(ctx, bson.M{"users": userID, "course": courseID})
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,770 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Message interface {
+	GetID() primitive.ObjectID
+	GetContent() string
+	GetUser() primitive.ObjectID
+	GetDate() primitive.DateTime
+	GetKind() string
+	Base() *MessageBase
+}
+
+// MessageBase holds the fields shared by every message kind. Kind is the
+// discriminator used to decode a stored message back into its concrete type.
+type MessageBase struct {
+	ID      primitive.ObjectID `bson:"_id,omitempty"`
+	Tribune primitive.ObjectID `bson:"tribune,omitempty"`
+	Kind    string             `bson:"kind"`
+	Content string             `bson:"content"`
+	User    primitive.ObjectID `bson:"user"`
+	Date    primitive.DateTime `bson:"date"`
+
+	// Mentions are the tribune members addressed with @username.
+	Mentions []primitive.ObjectID `bson:"mentions,omitempty"`
+
+	// ReplyTo is the root message of the thread this message replies to.
+	ReplyTo     primitive.ObjectID `bson:"replyTo,omitempty"`
+	ReplyCount  int                `bson:"replyCount,omitempty"`
+	LastReplyAt primitive.DateTime `bson:"lastReplyAt,omitempty"`
+	// Reactions maps an emoji to the users who reacted with it.
+	Reactions map[string][]primitive.ObjectID `bson:"reactions,omitempty"`
+	// Question marks a thread as a question that a maintainer can answer.
+	Question   bool               `bson:"question,omitempty"`
+	Answered   bool               `bson:"answered,omitempty"`
+	AnsweredBy primitive.ObjectID `bson:"answeredBy,omitempty"`
+	Answer     primitive.ObjectID `bson:"answer,omitempty"`
+
+	Edits     []MessageEdit      `bson:"edits,omitempty"`
+	EditedAt  primitive.DateTime `bson:"editedAt,omitempty"`
+	Deleted   bool               `bson:"deleted,omitempty"`
+	DeletedAt primitive.DateTime `bson:"deletedAt,omitempty"`
+	DeletedBy primitive.ObjectID `bson:"deletedBy,omitempty"`
+	// Hidden messages are kept out of view by a moderator but can be
+	// restored, unlike deleted ones.
+	Hidden   bool               `bson:"hidden,omitempty"`
+	HiddenAt primitive.DateTime `bson:"hiddenAt,omitempty"`
+	HiddenBy primitive.ObjectID `bson:"hiddenBy,omitempty"`
+}
+
+// MessageEdit keeps the content a message had before an edit.
+type MessageEdit struct {
+	Content string             `bson:"content"`
+	Date    primitive.DateTime `bson:"date"`
+}
+
+// Redact hides the content of a soft deleted or hidden message from readers.
+func (mb *MessageBase) Redact() {
+	if mb.Deleted || mb.Hidden {
+		mb.Content = ""
+		mb.Edits = nil
+	}
+}
+
+// redactor is implemented by kinds that hide more than the base fields
+// from readers.
+type redactor interface {
+	redact()
+}
+
+// RedactMessage prepares a stored message for readers.
+func RedactMessage(message Message) {
+	message.Base().Redact()
+	if r, ok := message.(redactor); ok {
+		r.redact()
+	}
+}
+
+func (mb *MessageBase) GetID() primitive.ObjectID   { return mb.ID }
+func (mb *MessageBase) GetContent() string          { return mb.Content }
+func (mb *MessageBase) GetUser() primitive.ObjectID { return mb.User }
+func (mb *MessageBase) GetDate() primitive.DateTime { return mb.Date }
+func (mb *MessageBase) Base() *MessageBase          { return mb }
+
+type MessageKinds struct {
+	PlainText    string
+	Assignment   string
+	Announcement string
+	Poll         string
+	File         string
+	Quiz         string
+}
+
+var MessageKind = MessageKinds{
+	PlainText:    "plaintext",
+	Assignment:   "assignment",
+	Announcement: "announcement",
+	Poll:         "poll",
+	File:         "file",
+	Quiz:         "quiz",
+}
+
+type PlainText struct {
+	MessageBase `bson:",inline"`
+}
+
+func (pt *PlainText) GetKind() string { return MessageKind.PlainText }
+
+type Assignment struct {
+	MessageBase `bson:",inline"`
+	DeadLine    primitive.DateTime `bson:"deadline"`
+	MaxGrade    float64            `bson:"maxGrade"`
+	// LatePolicy decides what happens to submissions after the deadline.
+	LatePolicy string `bson:"latePolicy"`
+	// LatePenalty is the percentage taken off the grade of a late submission
+	// under the penalty policy.
+	LatePenalty float64 `bson:"latePenalty"`
+	// LateCutoff closes late submissions entirely, zero means never.
+	LateCutoff primitive.DateTime `bson:"lateCutoff,omitempty"`
+}
+
+type LatePolicies struct {
+	Reject  string
+	Accept  string
+	Penalty string
+}
+
+var LatePolicy = LatePolicies{
+	Reject:  "reject",
+	Accept:  "accept",
+	Penalty: "penalty",
+}
+
+// AcceptsSubmissionAt reports whether a submission made at t is allowed and
+// whether it counts as late.
+func (a *Assignment) AcceptsSubmissionAt(t time.Time) (allowed bool, late bool) {
+	if a.DeadLine == 0 || !t.After(a.DeadLine.Time()) {
+		return true, false
+	}
+	if a.LatePolicy == "" || a.LatePolicy == LatePolicy.Reject {
+		return false, true
+	}
+	if a.LateCutoff != 0 && t.After(a.LateCutoff.Time()) {
+		return false, true
+	}
+	return true, true
+}
+
+func (a *Assignment) GetKind() string { return MessageKind.Assignment }
+
+type Announcement struct {
+	MessageBase `bson:",inline"`
+	Title       string `bson:"title"`
+	Pinned      bool   `bson:"pinned"`
+}
+
+func (a *Announcement) GetKind() string { return MessageKind.Announcement }
+
+func (a *Announcement) filteredText() []*string { return []*string{&a.Title} }
+
+type PollOption struct {
+	ID    primitive.ObjectID   `bson:"_id"`
+	Text  string               `bson:"text"`
+	Votes []primitive.ObjectID `bson:"votes"`
+	// Count is filled in when the poll is read, so anonymous polls can
+	// report results without their voters.
+	Count int `bson:"-"`
+}
+
+type Poll struct {
+	MessageBase    `bson:",inline"`
+	Options        []PollOption `bson:"options"`
+	MultipleChoice bool         `bson:"multipleChoice"`
+	// Anonymous polls never reveal who voted for what, not even to the
+	// maintainers.
+	Anonymous bool               `bson:"anonymous"`
+	ClosesAt  primitive.DateTime `bson:"closesAt,omitempty"`
+}
+
+func (p *Poll) GetKind() string { return MessageKind.Poll }
+
+func (p *Poll) filteredText() []*string {
+	fields := []*string{}
+	for i := range p.Options {
+		fields = append(fields, &p.Options[i].Text)
+	}
+	return fields
+}
+
+// IsClosed reports whether the poll stopped accepting votes at t.
+func (p *Poll) IsClosed(t time.Time) bool {
+	return p.ClosesAt != 0 && !t.Before(p.ClosesAt.Time())
+}
+
+func (p *Poll) redact() {
+	for i := range p.Options {
+		p.Options[i].Count = len(p.Options[i].Votes)
+		if p.Anonymous {
+			p.Options[i].Votes = nil
+		}
+	}
+}
+
+// QuizQuestion is a multiple choice question. Correct holds the indexes of
+// the right options, all of which must be chosen to earn the points.
+type QuizQuestion struct {
+	ID      primitive.ObjectID `bson:"_id"`
+	Text    string             `bson:"text"`
+	Options []string           `bson:"options"`
+	Correct []int              `bson:"correct"`
+	Points  float64            `bson:"points"`
+}
+
+// Quiz is a graded poll. Each student answers once and the score is
+// recorded in the tribune's gradebook.
+type Quiz struct {
+	MessageBase `bson:",inline"`
+	Questions   []QuizQuestion     `bson:"questions"`
+	ClosesAt    primitive.DateTime `bson:"closesAt,omitempty"`
+}
+
+func (q *Quiz) GetKind() string { return MessageKind.Quiz }
+
+func (q *Quiz) filteredText() []*string {
+	fields := []*string{}
+	for i := range q.Questions {
+		question := &q.Questions[i]
+		fields = append(fields, &question.Text)
+		for j := range question.Options {
+			fields = append(fields, &question.Options[j])
+		}
+	}
+	return fields
+}
+
+func (q *Quiz) IsClosed(t time.Time) bool {
+	return q.ClosesAt != 0 && !t.Before(q.ClosesAt.Time())
+}
+
+func (q *Quiz) MaxScore() float64 {
+	total := 0.0
+	for _, question := range q.Questions {
+		total += question.Points
+	}
+	return total
+}
+
+// redact keeps the answer key secret until the quiz closes.
+func (q *Quiz) redact() {
+	if q.IsClosed(time.Now()) {
+		return
+	}
+	for i := range q.Questions {
+		q.Questions[i].Correct = nil
+	}
+}
+
+// MessageFileBucket is the GridFS bucket of files posted in tribunes.
+const MessageFileBucket = "messagefiles"
+
+// File is a message with an attachment. The file is described by the upload
+// stored on the server, never by the client.
+type File struct {
+	MessageBase `bson:",inline"`
+	StoredFile  `bson:",inline"`
+}
+
+func (f *File) GetKind() string { return MessageKind.File }
+
+func (f *File) filteredText() []*string { return []*string{&f.Filename} }
+
+// redact hides the attachment of a deleted or hidden file message.
+func (f *File) redact() {
+	if f.Deleted || f.Hidden {
+		f.StoredFile = StoredFile{}
+	}
+}
+
+var (
+	messageRegistry   = map[string]func() Message{}
+	messageRegistryMu sync.RWMutex
+)
+
+// RegisterMessageKind makes a message kind decodable from BSON and JSON.
+func RegisterMessageKind(kind string, factory func() Message) {
+	messageRegistryMu.Lock()
+	defer messageRegistryMu.Unlock()
+	messageRegistry[kind] = factory
+}
+
+func init() {
+	RegisterMessageKind(MessageKind.PlainText, func() Message { return &PlainText{} })
+	RegisterMessageKind(MessageKind.Assignment, func() Message { return &Assignment{} })
+	RegisterMessageKind(MessageKind.Announcement, func() Message { return &Announcement{} })
+	RegisterMessageKind(MessageKind.Poll, func() Message { return &Poll{} })
+	RegisterMessageKind(MessageKind.File, func() Message { return &File{} })
+	RegisterMessageKind(MessageKind.Quiz, func() Message { return &Quiz{} })
+}
+
+// NewMessage returns an empty message of the given kind.
+func NewMessage(kind string) (Message, error) {
+	messageRegistryMu.RLock()
+	factory, ok := messageRegistry[kind]
+	messageRegistryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown message kind %q", kind)
+	}
+	message := factory()
+	message.Base().Kind = kind
+	return message, nil
+}
+
+// stampKind makes sure the discriminator is written along with the message.
+func stampKind(message Message) Message {
+	message.Base().Kind = message.GetKind()
+	return message
+}
+
+// DecodeMessage decodes a stored message into its concrete type. Messages
+// written before the kind field existed are treated as plain text, or as
+// assignments when they carry a deadline.
+func DecodeMessage(raw bson.Raw) (Message, error) {
+	kind, ok := raw.Lookup("kind").StringValueOK()
+	if !ok || kind == "" {
+		kind = MessageKind.PlainText
+		if _, err := raw.LookupErr("deadline"); err == nil {
+			kind = MessageKind.Assignment
+		}
+	}
+	message, err := NewMessage(kind)
+	if err != nil {
+		return nil, err
+	}
+	if err := bson.Unmarshal(raw, message); err != nil {
+		return nil, err
+	}
+	message.Base().Kind = kind
+	return message, nil
+}
+
+// DecodeMessageJSON decodes a message from its JSON form using the "Kind"
+// field, defaulting to plain text.
+func DecodeMessageJSON(data []byte) (Message, error) {
+	var header struct {
+		Kind string
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, err
+	}
+	if header.Kind == "" {
+		header.Kind = MessageKind.PlainText
+	}
+	message, err := NewMessage(header.Kind)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, message); err != nil {
+		return nil, err
+	}
+	message.Base().Kind = header.Kind
+	return message, nil
+}
+
+// MessageList is a slice of messages of mixed kinds that round-trips through
+// BSON and JSON with each element decoded into its concrete type.
+type MessageList []Message
+
+func (ml MessageList) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	values := bson.A{}
+	for _, message := range ml {
+		values = append(values, stampKind(message))
+	}
+	return bson.MarshalValue(values)
+}
+
+func (ml *MessageList) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	if t == bson.TypeNull || t == bson.TypeUndefined {
+		*ml = nil
+		return nil
+	}
+	if t != bson.TypeArray {
+		return fmt.Errorf("cannot decode %v into a message list", t)
+	}
+
+	values, err := bson.RawValue{Type: t, Value: data}.Array().Values()
+	if err != nil {
+		return err
+	}
+	messages := make(MessageList, 0, len(values))
+	for _, value := range values {
+		raw, ok := value.DocumentOK()
+		if !ok {
+			return fmt.Errorf("message is not a document")
+		}
+		message, err := DecodeMessage(raw)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, message)
+	}
+	*ml = messages
+	return nil
+}
+
+func (ml MessageList) MarshalJSON() ([]byte, error) {
+	messages := make([]Message, 0, len(ml))
+	for _, message := range ml {
+		messages = append(messages, stampKind(message))
+	}
+	return json.Marshal(messages)
+}
+
+func (ml *MessageList) UnmarshalJSON(data []byte) error {
+	var raws []json.RawMessage
+	if err := json.Unmarshal(data, &raws); err != nil {
+		return err
+	}
+	messages := make(MessageList, 0, len(raws))
+	for _, raw := range raws {
+		message, err := DecodeMessageJSON(raw)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, message)
+	}
+	*ml = messages
+	return nil
+}
+
+const (
+	DefaultMessagePageSize = 50
+	MaxMessagePageSize     = 200
+)
+
+// PostMessage stores a message in the messages collection of the tribune.
+func PostMessage(message Message, id primitive.ObjectID) (*mongo.InsertOneResult, error) {
+	base := message.Base()
+	base.Tribune = id
+	if base.ID.IsZero() {
+		base.ID = primitive.NewObjectID()
+	}
+	if base.Date == 0 {
+		base.Date = primitive.NewDateTimeFromTime(time.Now())
+	}
+
+	collection := GetCollection("messages")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return collection.InsertOne(ctx, stampKind(message))
+}
+
+func GetMessageByID(id primitive.ObjectID) (Message, error) {
+	collection := GetCollection("messages")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	raw, err := collection.FindOne(ctx, bson.M{"_id": id}).Raw()
+	if err != nil {
+		return nil, err
+	}
+	return DecodeMessage(raw)
+}
+
+// EditMessage replaces the content of a message, keeping the previous
+// content in its edit history.
+func EditMessage(id primitive.ObjectID, content string) (*mongo.UpdateResult, error) {
+	message, err := GetMessageByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if message.Base().Deleted {
+		return nil, fmt.Errorf("message has been deleted")
+	}
+
+	collection := GetCollection("messages")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+	update := bson.M{
+		"$set":  bson.M{"content": content, "editedAt": now},
+		"$push": bson.M{"edits": MessageEdit{Content: message.GetContent(), Date: now}},
+	}
+	// only apply the edit if nobody changed the message in the meantime
+	filter := bson.M{"_id": id, "content": message.GetContent(), "deleted": bson.M{"$ne": true}}
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, fmt.Errorf("message was changed concurrently, try again")
+	}
+	return result, nil
+}
+
+// DeleteMessage soft deletes a message so its place in the thread is kept.
+func DeleteMessage(id primitive.ObjectID, deletedBy primitive.ObjectID) (*mongo.UpdateResult, error) {
+	collection := GetCollection("messages")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$set": bson.M{
+			"deleted":   true,
+			"deletedAt": primitive.NewDateTimeFromTime(time.Now()),
+			"deletedBy": deletedBy,
+		},
+	}
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": id, "deleted": bson.M{"$ne": true}}, update)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, fmt.Errorf("message not found")
+	}
+	return result, nil
+}
+
+// SetMessageHidden hides a message from readers or restores it.
+func SetMessageHidden(id primitive.ObjectID, hidden bool, by primitive.ObjectID) (*mongo.UpdateResult, error) {
+	collection := GetCollection("messages")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"$unset": bson.M{"hidden": "", "hiddenAt": "", "hiddenBy": ""}}
+	if hidden {
+		update = bson.M{"$set": bson.M{
+			"hidden":   true,
+			"hiddenAt": primitive.NewDateTimeFromTime(time.Now()),
+			"hiddenBy": by,
+		}}
+	}
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": id, "deleted": bson.M{"$ne": true}}, update)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, fmt.Errorf("message not found")
+	}
+	return result, nil
+}
+
+// MessagePage is one page of a tribune's messages, newest first. Before and
+// After are the cursors for the next older and next newer pages.
+type MessagePage struct {
+	Messages MessageList
+	Before   primitive.ObjectID
+	After    primitive.ObjectID
+	HasMore  bool
+}
+
+// GetTribuneMessages pages through the top level messages of a tribune by
+// message id, newest first. With before set it returns messages older than
+// it, with after set messages newer than it, and with neither the latest.
+func GetTribuneMessages(tribuneID primitive.ObjectID, before, after primitive.ObjectID, limit int64) (MessagePage, error) {
+	filter := bson.M{"tribune": tribuneID, "replyTo": bson.M{"$exists": false}}
+	return getMessagePage(filter, before, after, limit)
+}
+
+// GetThreadReplies pages through the replies to a root message the same way
+// GetTribuneMessages pages through a tribune.
+func GetThreadReplies(rootID primitive.ObjectID, before, after primitive.ObjectID, limit int64) (MessagePage, error) {
+	return getMessagePage(bson.M{"replyTo": rootID}, before, after, limit)
+}
+
+func getMessagePage(filter bson.M, before, after primitive.ObjectID, limit int64) (MessagePage, error) {
+	var page MessagePage
+	if limit <= 0 || limit > MaxMessagePageSize {
+		limit = DefaultMessagePageSize
+	}
+
+	sort := -1
+	if !before.IsZero() {
+		filter["_id"] = bson.M{"$lt": before}
+	} else if !after.IsZero() {
+		filter["_id"] = bson.M{"$gt": after}
+		sort = 1
+	}
+
+	collection := GetCollection("messages")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// fetch one extra message to know whether another page exists
+	opts := options.Find().SetSort(bson.M{"_id": sort}).SetLimit(limit + 1)
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return page, err
+	}
+	defer cursor.Close(ctx)
+
+	messages, err := decodeMessages(ctx, cursor)
+	if err != nil {
+		return page, err
+	}
+	if int64(len(messages)) > limit {
+		page.HasMore = true
+		messages = messages[:limit]
+	}
+	if sort == 1 {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+
+	page.Messages = messages
+	if len(messages) > 0 {
+		page.After = messages[0].GetID()
+		page.Before = messages[len(messages)-1].GetID()
+	}
+	return page, nil
+}
+
+// PostReply stores a reply in the thread of root and bumps the thread's
+// reply count.
+func PostReply(message Message, root Message) (*mongo.InsertOneResult, error) {
+	message.Base().ReplyTo = root.GetID()
+	result, err := PostMessage(message, root.Base().Tribune)
+	if err != nil {
+		return nil, err
+	}
+
+	collection := GetCollection("messages")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	update := bson.M{
+		"$inc": bson.M{"replyCount": 1},
+		"$max": bson.M{"lastReplyAt": message.GetDate()},
+	}
+	_, err = collection.UpdateByID(ctx, root.GetID(), update)
+	return result, err
+}
+
+// IsValidReaction rejects reactions that cannot be used as a document key.
+func IsValidReaction(emoji string) bool {
+	return emoji != "" && len(emoji) <= 32 && !strings.ContainsAny(emoji, ".$ \t\n")
+}
+
+// AddReaction records the user's reaction. A user can react with each emoji
+// only once.
+func AddReaction(id primitive.ObjectID, emoji string, userID primitive.ObjectID) (*mongo.UpdateResult, error) {
+	if !IsValidReaction(emoji) {
+		return nil, fmt.Errorf("invalid reaction")
+	}
+	collection := GetCollection("messages")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	update := bson.M{"$addToSet": bson.M{"reactions." + emoji: userID}}
+	return collection.UpdateOne(ctx, bson.M{"_id": id, "deleted": bson.M{"$ne": true}}, update)
+}
+
+func RemoveReaction(id primitive.ObjectID, emoji string, userID primitive.ObjectID) (*mongo.UpdateResult, error) {
+	if !IsValidReaction(emoji) {
+		return nil, fmt.Errorf("invalid reaction")
+	}
+	collection := GetCollection("messages")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	update := bson.M{"$pull": bson.M{"reactions." + emoji: userID}}
+	result, err := collection.UpdateByID(ctx, id, update)
+	if err != nil {
+		return nil, err
+	}
+	// drop emojis nobody reacts with any more
+	collection.UpdateOne(ctx, bson.M{"_id": id, "reactions." + emoji: bson.M{"$size": 0}}, bson.M{"$unset": bson.M{"reactions." + emoji: ""}})
+	return result, nil
+}
+
+// MarkAnswered marks a question thread as answered, optionally pointing at
+// the reply that answers it.
+func MarkAnswered(rootID primitive.ObjectID, answer primitive.ObjectID, answeredBy primitive.ObjectID) (*mongo.UpdateResult, error) {
+	collection := GetCollection("messages")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	set := bson.M{"answered": true, "answeredBy": answeredBy}
+	update := bson.M{"$set": set}
+	if answer.IsZero() {
+		update["$unset"] = bson.M{"answer": ""}
+	} else {
+		set["answer"] = answer
+	}
+	return collection.UpdateOne(ctx, bson.M{"_id": rootID, "question": true}, update)
+}
+
+func UnmarkAnswered(rootID primitive.ObjectID) (*mongo.UpdateResult, error) {
+	collection := GetCollection("messages")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	update := bson.M{"$unset": bson.M{"answered": "", "answeredBy": "", "answer": ""}}
+	return collection.UpdateOne(ctx, bson.M{"_id": rootID, "question": true}, update)
+}
+
+func decodeMessages(ctx context.Context, cursor *mongo.Cursor) (MessageList, error) {
+	messages := MessageList{}
+	for cursor.Next(ctx) {
+		message, err := DecodeMessage(cursor.Current)
+		if err != nil {
+			continue
+		}
+		RedactMessage(message)
+		messages = append(messages, message)
+	}
+	return messages, cursor.Err()
+}
+
+// MigrateEmbeddedMessages moves messages still embedded in tribune documents
+// into the messages collection. It is safe to run repeatedly: messages are
+// upserted by id and the embedded array is only removed once copied.
+func MigrateEmbeddedMessages() (int, error) {
+	tribuneCollection := GetCollection("tribune")
+	messageCollection := GetCollection("messages")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	filter := bson.M{"messages": bson.M{"$exists": true}}
+	opts := options.Find().SetProjection(bson.M{"messages": 1})
+	cursor, err := tribuneCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	moved := 0
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID       primitive.ObjectID `bson:"_id"`
+			Messages MessageList        `bson:"messages"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return moved, fmt.Errorf("failed to decode messages of tribune %s: %v", cursor.Current.Lookup("_id"), err)
+		}
+
+		var writes []mongo.WriteModel
+		for _, message := range doc.Messages {
+			base := message.Base()
+			base.Tribune = doc.ID
+			if base.ID.IsZero() {
+				base.ID = primitive.NewObjectIDFromTimestamp(base.Date.Time())
+			}
+			writes = append(writes, mongo.NewReplaceOneModel().
+				SetFilter(bson.M{"_id": base.ID}).
+				SetReplacement(stampKind(message)).
+				SetUpsert(true))
+		}
+		if len(writes) > 0 {
+			if _, err := messageCollection.BulkWrite(ctx, writes); err != nil {
+				return moved, fmt.Errorf("failed to move messages of tribune %s: %v", doc.ID.Hex(), err)
+			}
+		}
+		if _, err := tribuneCollection.UpdateByID(ctx, doc.ID, bson.M{"$unset": bson.M{"messages": ""}}); err != nil {
+			return moved, err
+		}
+		moved += len(writes)
+	}
+	return moved, cursor.Err()
+}
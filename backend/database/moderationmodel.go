@@ -0,0 +1,363 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ReportStatuses struct {
+	Open      string
+	Resolved  string
+	Dismissed string
+}
+
+var ReportStatus = ReportStatuses{
+	Open:      "open",
+	Resolved:  "resolved",
+	Dismissed: "dismissed",
+}
+
+type ModerationActions struct {
+	Hide    string
+	Unhide  string
+	Delete  string
+	Warn    string
+	Mute    string
+	Dismiss string
+}
+
+var ModerationAction = ModerationActions{
+	Hide:    "hide",
+	Unhide:  "unhide",
+	Delete:  "delete",
+	Warn:    "warn",
+	Mute:    "mute",
+	Dismiss: "dismiss",
+}
+
+// Report is a user's complaint about a message. The content is copied so
+// moderators can still review it once the message is hidden or edited.
+type Report struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Message    primitive.ObjectID `bson:"message" json:"message"`
+	Tribune    primitive.ObjectID `bson:"tribune" json:"tribune"`
+	Reporter   primitive.ObjectID `bson:"reporter" json:"reporter"`
+	Author     primitive.ObjectID `bson:"author" json:"author"`
+	Reason     string             `bson:"reason" json:"reason"`
+	Details    string             `bson:"details,omitempty" json:"details,omitempty"`
+	Content    string             `bson:"content" json:"content"`
+	Status     string             `bson:"status" json:"status"`
+	Action     string             `bson:"action,omitempty" json:"action,omitempty"`
+	CreatedAt  time.Time          `bson:"createdAt" json:"createdAt"`
+	ResolvedBy primitive.ObjectID `bson:"resolvedBy,omitempty" json:"resolvedBy,omitempty"`
+	ResolvedAt time.Time          `bson:"resolvedAt,omitempty" json:"resolvedAt,omitempty"`
+}
+
+// ReportReasons lists the reasons a message can be reported for.
+var ReportReasons = []string{"spam", "harassment", "inappropriate", "off-topic", "other"}
+
+func IsValidReportReason(reason string) bool {
+	for _, r := range ReportReasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateReport files a report. A user can report a message only once while
+// the report is open.
+func CreateReport(report Report) (*mongo.InsertOneResult, error) {
+	if report.ID.IsZero() {
+		report.ID = primitive.NewObjectID()
+	}
+	report.Status = ReportStatus.Open
+	report.CreatedAt = time.Now()
+
+	collection := GetCollection("reports")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, err := collection.InsertOne(ctx, report)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, fmt.Errorf("you already reported this message")
+	}
+	return result, err
+}
+
+func GetReportByID(id primitive.ObjectID) (Report, error) {
+	var report Report
+	collection := GetCollection("reports")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&report)
+	return report, err
+}
+
+// GetReports returns reports matching filter, oldest first so the queue is
+// worked in order.
+func GetReports(filter bson.M, limit int64) ([]Report, error) {
+	var reports []Report
+	collection := GetCollection("reports")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"createdAt": 1}).SetLimit(limit)
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var report Report
+		if err := cursor.Decode(&report); err != nil {
+			continue
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// ResolveReports closes every open report on a message with the action taken.
+func ResolveReports(messageID primitive.ObjectID, action string, by primitive.ObjectID) (*mongo.UpdateResult, error) {
+	collection := GetCollection("reports")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	status := ReportStatus.Resolved
+	if action == ModerationAction.Dismiss {
+		status = ReportStatus.Dismissed
+	}
+	update := bson.M{"$set": bson.M{
+		"status":     status,
+		"action":     action,
+		"resolvedBy": by,
+		"resolvedAt": time.Now(),
+	}}
+	return collection.UpdateMany(ctx, bson.M{"message": messageID, "status": ReportStatus.Open}, update)
+}
+
+// Mute keeps a user from posting in a tribune until it expires.
+type Mute struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Tribune   primitive.ObjectID `bson:"tribune" json:"tribune"`
+	User      primitive.ObjectID `bson:"user" json:"user"`
+	Reason    string             `bson:"reason,omitempty" json:"reason,omitempty"`
+	MutedBy   primitive.ObjectID `bson:"mutedBy" json:"mutedBy"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	Until     time.Time          `bson:"until" json:"until"`
+}
+
+// MuteUser mutes a user in a tribune, replacing an existing mute.
+func MuteUser(mute Mute) (*mongo.UpdateResult, error) {
+	collection := GetCollection("mutes")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$set": bson.M{
+			"reason":    mute.Reason,
+			"mutedBy":   mute.MutedBy,
+			"createdAt": time.Now(),
+			"until":     mute.Until,
+		},
+	}
+	filter := bson.M{"tribune": mute.Tribune, "user": mute.User}
+	return collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+}
+
+func UnmuteUser(tribuneID primitive.ObjectID, userID primitive.ObjectID) (*mongo.DeleteResult, error) {
+	collection := GetCollection("mutes")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return collection.DeleteOne(ctx, bson.M{"tribune": tribuneID, "user": userID})
+}
+
+// GetActiveMute returns the user's mute in a tribune if it has not expired.
+// Expired mutes are removed by a TTL index, but that runs only periodically.
+func GetActiveMute(tribuneID primitive.ObjectID, userID primitive.ObjectID) (Mute, bool) {
+	var mute Mute
+	collection := GetCollection("mutes")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"tribune": tribuneID, "user": userID, "until": bson.M{"$gt": time.Now()}}
+	if err := collection.FindOne(ctx, filter).Decode(&mute); err != nil {
+		return mute, false
+	}
+	return mute, true
+}
+
+func GetActiveMutes(tribuneID primitive.ObjectID) ([]Mute, error) {
+	var mutes []Mute
+	collection := GetCollection("mutes")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"tribune": tribuneID, "until": bson.M{"$gt": time.Now()}}
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(bson.M{"until": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var mute Mute
+		if err := cursor.Decode(&mute); err != nil {
+			continue
+		}
+		mutes = append(mutes, mute)
+	}
+	return mutes, nil
+}
+
+type WordFilterActions struct {
+	Block string
+	Mask  string
+}
+
+var WordFilterAction = WordFilterActions{
+	Block: "block",
+	Mask:  "mask",
+}
+
+// WordFilter rejects or masks a word in new messages. A filter without a
+// tribune applies everywhere.
+type WordFilter struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Tribune   primitive.ObjectID `bson:"tribune,omitempty" json:"tribune,omitempty"`
+	Word      string             `bson:"word" json:"word"`
+	Action    string             `bson:"action" json:"action"`
+	CreatedBy primitive.ObjectID `bson:"createdBy" json:"createdBy"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+func (f WordFilter) pattern() *regexp.Regexp {
+	return regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(f.Word) + `\b`)
+}
+
+func CreateWordFilter(filter WordFilter) (*mongo.InsertOneResult, error) {
+	filter.Word = strings.TrimSpace(filter.Word)
+	if filter.Word == "" || len(filter.Word) > 100 {
+		return nil, fmt.Errorf("invalid word")
+	}
+	if filter.Action != WordFilterAction.Block && filter.Action != WordFilterAction.Mask {
+		return nil, fmt.Errorf("invalid filter action")
+	}
+	if filter.ID.IsZero() {
+		filter.ID = primitive.NewObjectID()
+	}
+	filter.CreatedAt = time.Now()
+
+	collection := GetCollection("wordfilters")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return collection.InsertOne(ctx, filter)
+}
+
+func GetWordFilterByID(id primitive.ObjectID) (WordFilter, error) {
+	var filter WordFilter
+	collection := GetCollection("wordfilters")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&filter)
+	return filter, err
+}
+
+func DeleteWordFilter(id primitive.ObjectID) (*mongo.DeleteResult, error) {
+	collection := GetCollection("wordfilters")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return collection.DeleteOne(ctx, bson.M{"_id": id})
+}
+
+// GetWordFilters returns the filters of a tribune. With global set the
+// filters that apply everywhere are included.
+func GetWordFilters(tribuneID primitive.ObjectID, global bool) ([]WordFilter, error) {
+	var filters []WordFilter
+	collection := GetCollection("wordfilters")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := bson.M{"tribune": tribuneID}
+	if tribuneID.IsZero() {
+		query = bson.M{"tribune": bson.M{"$exists": false}}
+	} else if global {
+		query = bson.M{"$or": []bson.M{{"tribune": tribuneID}, {"tribune": bson.M{"$exists": false}}}}
+	}
+	cursor, err := collection.Find(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var filter WordFilter
+		if err := cursor.Decode(&filter); err != nil {
+			continue
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+// ApplyWordFilters checks content against the filters of a tribune and the
+// global ones. Masked words are replaced by asterisks, a blocked word
+// rejects the content.
+func ApplyWordFilters(tribuneID primitive.ObjectID, content string) (string, error) {
+	filters, err := GetWordFilters(tribuneID, true)
+	if err != nil {
+		return content, err
+	}
+	return filterWords(filters, content)
+}
+
+// filteredTexter is implemented by kinds with user supplied text besides the
+// content, such as poll options and quiz questions.
+type filteredTexter interface {
+	filteredText() []*string
+}
+
+// ApplyMessageWordFilters runs the word filters of a tribune over the
+// content and every other text field of a message.
+func ApplyMessageWordFilters(tribuneID primitive.ObjectID, message Message) error {
+	filters, err := GetWordFilters(tribuneID, true)
+	if err != nil {
+		return err
+	}
+	fields := []*string{&message.Base().Content}
+	if texter, ok := message.(filteredTexter); ok {
+		fields = append(fields, texter.filteredText()...)
+	}
+	for _, field := range fields {
+		if *field, err = filterWords(filters, *field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func filterWords(filters []WordFilter, content string) (string, error) {
+	for _, filter := range filters {
+		pattern := filter.pattern()
+		switch filter.Action {
+		case WordFilterAction.Block:
+			if pattern.MatchString(content) {
+				return content, fmt.Errorf("message contains a blocked word")
+			}
+		case WordFilterAction.Mask:
+			content = pattern.ReplaceAllStringFunc(content, func(word string) string {
+				return strings.Repeat("*", len([]rune(word)))
+			})
+		}
+	}
+	return content, nil
+}
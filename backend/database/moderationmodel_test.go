@@ -0,0 +1,49 @@
+package database
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestMessageWordFilters(t *testing.T) {
+	t.Setenv("MONGO_DATABASE", "hermes")
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	tribuneID := primitive.NewObjectID()
+	filters := func(mt *mtest.T, words ...bson.D) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "hermes.wordfilters", mtest.FirstBatch, words...))
+	}
+	mask := bson.D{{Key: "word", Value: "darn"}, {Key: "action", Value: WordFilterAction.Mask}}
+	block := bson.D{{Key: "word", Value: "spoiler"}, {Key: "action", Value: WordFilterAction.Block}}
+
+	mt.Run("mask", func(mt *mtest.T) {
+		useMockDatabase(mt)
+		filters(mt, mask)
+
+		quiz := &Quiz{Questions: []QuizQuestion{{Text: "Darn or not?", Options: []string{"darn", "fine"}}}}
+		quiz.Content = "a darn quiz"
+		if err := ApplyMessageWordFilters(tribuneID, quiz); err != nil {
+			mt.Fatal(err)
+		}
+		if quiz.Content != "a **** quiz" || quiz.Questions[0].Text != "**** or not?" || quiz.Questions[0].Options[0] != "****" {
+			mt.Fatalf("quiz was not masked: %q %+v", quiz.Content, quiz.Questions)
+		}
+	})
+
+	mt.Run("block", func(mt *mtest.T) {
+		useMockDatabase(mt)
+		texts := map[string]Message{
+			"poll option":        &Poll{Options: []PollOption{{Text: "yes"}, {Text: "spoiler"}}},
+			"announcement title": &Announcement{Title: "Spoiler alert"},
+			"file name":          &File{StoredFile: StoredFile{Filename: "spoiler.pdf"}},
+		}
+		for field, message := range texts {
+			filters(mt, block)
+			if err := ApplyMessageWordFilters(tribuneID, message); err == nil {
+				mt.Fatalf("blocked word in the %s was accepted", field)
+			}
+		}
+	})
+}
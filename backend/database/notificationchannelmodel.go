@@ -0,0 +1,368 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"hermes/helpers"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// NotificationChannel is a named stream of notifications users subscribe to.
+// Users with one of Roles, or enrolled in one of Courses, are subscribed
+// automatically. Others can subscribe themselves only to public channels.
+type NotificationChannel struct {
+	ID          primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Name        string               `bson:"name" json:"name"`
+	Description string               `bson:"description,omitempty" json:"description,omitempty"`
+	Roles       []string             `bson:"roles,omitempty" json:"roles,omitempty"`
+	Courses     []primitive.ObjectID `bson:"courses,omitempty" json:"courses,omitempty"`
+	Public      bool                 `bson:"public" json:"public"`
+	// Mandatory channels cannot be unsubscribed from.
+	Mandatory bool               `bson:"mandatory" json:"mandatory"`
+	CreatedBy primitive.ObjectID `bson:"createdBy,omitempty" json:"createdBy,omitempty"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// builtinNotificationChannels are the channels every installation has. Their
+// ids are fixed because notifications are sent to them from code.
+var builtinNotificationChannels = []NotificationChannel{
+	{
+		ID:          helpers.AnnouncementsChannelID,
+		Name:        "Announcements",
+		Description: "University-wide announcements",
+		Roles:       []string{UserRole.Admin, UserRole.Moderator, UserRole.Staff, UserRole.Student},
+		Public:      true,
+	},
+	{
+		ID:          helpers.SystemAlertsChannelID,
+		Name:        "System alerts",
+		Description: "Maintenance and security alerts",
+		Roles:       []string{UserRole.Admin, UserRole.Moderator, UserRole.Staff, UserRole.Student},
+		Public:      true,
+		Mandatory:   true,
+	},
+}
+
+// HasRole reports whether the channel subscribes users with the role.
+func (ch NotificationChannel) HasRole(role string) bool {
+	for _, r := range ch.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// CanSubscribe reports whether the user may subscribe to the channel.
+func (ch NotificationChannel) CanSubscribe(user User) bool {
+	if ch.Public || ch.HasRole(user.Role) {
+		return true
+	}
+	for _, course := range ch.Courses {
+		if enrolled, _ := IsUserEnrolledInCourse(user.ID, course); enrolled {
+			return true
+		}
+	}
+	return false
+}
+
+func validateNotificationChannel(ch *NotificationChannel) error {
+	ch.Name = strings.TrimSpace(ch.Name)
+	if ch.Name == "" || len(ch.Name) > 100 {
+		return fmt.Errorf("invalid channel name")
+	}
+	for _, role := range ch.Roles {
+		if role != UserRole.Admin && role != UserRole.Moderator && role != UserRole.Staff && role != UserRole.Student {
+			return fmt.Errorf("invalid role %q", role)
+		}
+	}
+	return nil
+}
+
+// CreateNotificationChannel stores a channel and subscribes the users its
+// rules match.
+func CreateNotificationChannel(ch NotificationChannel) (*mongo.InsertOneResult, error) {
+	if err := validateNotificationChannel(&ch); err != nil {
+		return nil, err
+	}
+	if ch.ID.IsZero() {
+		ch.ID = primitive.NewObjectID()
+	}
+	ch.CreatedAt = time.Now()
+
+	collection := GetCollection("notificationchannels")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, err := collection.InsertOne(ctx, ch)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, fmt.Errorf("channel name already exists")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := applyChannelRules(ch); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+func GetNotificationChannelByID(id primitive.ObjectID) (NotificationChannel, error) {
+	var ch NotificationChannel
+	collection := GetCollection("notificationchannels")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&ch)
+	return ch, err
+}
+
+func GetNotificationChannels() ([]NotificationChannel, error) {
+	var channels []NotificationChannel
+	collection := GetCollection("notificationchannels")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var ch NotificationChannel
+		if err := cursor.Decode(&ch); err != nil {
+			continue
+		}
+		channels = append(channels, ch)
+	}
+	return channels, nil
+}
+
+// UpdateNotificationChannel changes a channel and subscribes the users its
+// new rules match. Existing subscribers are kept.
+func UpdateNotificationChannel(id primitive.ObjectID, ch NotificationChannel) (*mongo.UpdateResult, error) {
+	if err := validateNotificationChannel(&ch); err != nil {
+		return nil, err
+	}
+	collection := GetCollection("notificationchannels")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{
+		"name":        ch.Name,
+		"description": ch.Description,
+		"roles":       ch.Roles,
+		"courses":     ch.Courses,
+		"public":      ch.Public,
+		"mandatory":   ch.Mandatory,
+	}}
+	result, err := collection.UpdateByID(ctx, id, update)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, fmt.Errorf("channel name already exists")
+	}
+	if err != nil {
+		return nil, err
+	}
+	ch.ID = id
+	if err := applyChannelRules(ch); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// DeleteNotificationChannel removes a channel and every subscription to it.
+// The builtin channels cannot be deleted.
+func DeleteNotificationChannel(id primitive.ObjectID) (*mongo.DeleteResult, error) {
+	for _, builtin := range builtinNotificationChannels {
+		if builtin.ID == id {
+			return nil, fmt.Errorf("builtin channels cannot be deleted")
+		}
+	}
+	collection := GetCollection("notificationchannels")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return nil, err
+	}
+	subscribers, err := channelSubscribers(ctx, bson.M{"notificationsubs": id})
+	if err != nil {
+		return result, err
+	}
+	_, err = GetCollection("users").UpdateMany(ctx, bson.M{"notificationsubs": id}, bson.M{"$pull": bson.M{"notificationsubs": id}})
+	notifySubscriptionsChanged(subscribers)
+	return result, err
+}
+
+// applyChannelRules subscribes every user the channel's roles and courses
+// match.
+func applyChannelRules(ch NotificationChannel) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var match []bson.M
+	if len(ch.Roles) > 0 {
+		match = append(match, bson.M{"role": bson.M{"$in": ch.Roles}})
+	}
+	if len(ch.Courses) > 0 {
+		enrolled, err := GetCollection("lecture").Distinct(ctx, "users", bson.M{"course": bson.M{"$in": ch.Courses}})
+		if err != nil {
+			return err
+		}
+		match = append(match, bson.M{"_id": bson.M{"$in": enrolled}})
+	}
+	if len(match) == 0 {
+		return nil
+	}
+
+	filter := bson.M{"$or": match, "notificationsubs": bson.M{"$ne": ch.ID}}
+	subscribers, err := channelSubscribers(ctx, filter)
+	if err != nil {
+		return err
+	}
+	_, err = GetCollection("users").UpdateMany(ctx, filter, bson.M{"$addToSet": bson.M{"notificationsubs": ch.ID}})
+	notifySubscriptionsChanged(subscribers)
+	return err
+}
+
+func channelSubscribers(ctx context.Context, filter bson.M) ([]primitive.ObjectID, error) {
+	ids, err := GetCollection("users").Distinct(ctx, "_id", filter)
+	if err != nil {
+		return nil, err
+	}
+	users := make([]primitive.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		if oid, ok := id.(primitive.ObjectID); ok {
+			users = append(users, oid)
+		}
+	}
+	return users, nil
+}
+
+// notifySubscriptionsChanged lets the open notification streams of the users
+// pick up their new channels.
+func notifySubscriptionsChanged(users []primitive.ObjectID) {
+	for _, user := range users {
+		helpers.SendEvent(user, helpers.SubscriptionsChangedEvent, nil)
+	}
+}
+
+// GetUserNotificationChannels returns every channel a user receives
+// notifications on: the channels they subscribed to, the tribunes they
+// maintain or are a member of, and their own id for personal notifications.
+func GetUserNotificationChannels(userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	subs, err := GetUserNotificationSubs(userID)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	tribunes, err := GetCollection("tribune").Distinct(ctx, "_id", bson.M{"$or": []bson.M{
+		{"maintainers": userID},
+		{"members": userID},
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	channels := append(subs, userID)
+	for _, id := range tribunes {
+		if oid, ok := id.(primitive.ObjectID); ok {
+			channels = append(channels, oid)
+		}
+	}
+	return channels, nil
+}
+
+// RoleNotificationChannels returns the channels a new user with the role is
+// subscribed to.
+func RoleNotificationChannels(role string) []primitive.ObjectID {
+	channels := []primitive.ObjectID{}
+	collection := GetCollection("notificationchannels")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ids, err := collection.Distinct(ctx, "_id", bson.M{"roles": role})
+	if err != nil || len(ids) == 0 {
+		// fall back to the builtin channels so new users are never left
+		// without announcements
+		for _, builtin := range builtinNotificationChannels {
+			if builtin.HasRole(role) {
+				channels = append(channels, builtin.ID)
+			}
+		}
+		return channels
+	}
+	for _, id := range ids {
+		if oid, ok := id.(primitive.ObjectID); ok {
+			channels = append(channels, oid)
+		}
+	}
+	return channels
+}
+
+// SubscribeToCourseChannels subscribes a newly enrolled student to the
+// channels of the course.
+func SubscribeToCourseChannels(userID primitive.ObjectID, courseID primitive.ObjectID) error {
+	ids, err := courseChannelIDs(courseID)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	update := bson.M{"$addToSet": bson.M{"notificationsubs": bson.M{"$each": ids}}}
+	_, err = GetCollection("users").UpdateByID(ctx, userID, update)
+	helpers.SendEvent(userID, helpers.SubscriptionsChangedEvent, nil)
+	return err
+}
+
+// UnsubscribeFromCourseChannels drops the course channels of a student who
+// is no longer enrolled in any lecture of the course.
+func UnsubscribeFromCourseChannels(userID primitive.ObjectID, courseID primitive.ObjectID) error {
+	enrolled, err := IsUserEnrolledInCourse(userID, courseID)
+	if err != nil || enrolled {
+		return err
+	}
+	ids, err := courseChannelIDs(courseID)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	update := bson.M{"$pull": bson.M{"notificationsubs": bson.M{"$in": ids}}}
+	_, err = GetCollection("users").UpdateByID(ctx, userID, update)
+	helpers.SendEvent(userID, helpers.SubscriptionsChangedEvent, nil)
+	return err
+}
+
+func courseChannelIDs(courseID primitive.ObjectID) ([]interface{}, error) {
+	if courseID.IsZero() {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return GetCollection("notificationchannels").Distinct(ctx, "_id", bson.M{"courses": courseID})
+}
+
+// SeedNotificationChannels creates the builtin channels that do not exist
+// yet.
+func SeedNotificationChannels() error {
+	collection := GetCollection("notificationchannels")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, ch := range builtinNotificationChannels {
+		ch.CreatedAt = time.Now()
+		_, err := collection.UpdateOne(ctx, bson.M{"_id": ch.ID}, bson.M{"$setOnInsert": ch}, options.Update().SetUpsert(true))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,505 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"hermes/helpers"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type DeliveryModes struct {
+	InApp     string
+	Immediate string
+	Digest    string
+}
+
+// DeliveryMode is how a user receives the notifications of a channel besides
+// the inbox.
+var DeliveryMode = DeliveryModes{
+	InApp:     "inapp",
+	Immediate: "immediate",
+	Digest:    "digest",
+}
+
+func IsValidDeliveryMode(mode string) bool {
+	return mode == DeliveryMode.InApp || mode == DeliveryMode.Immediate || mode == DeliveryMode.Digest
+}
+
+type DeliveryStatuses struct {
+	Pending string
+	Sending string
+	Sent    string
+	Failed  string
+}
+
+var DeliveryStatus = DeliveryStatuses{
+	Pending: "pending",
+	Sending: "sending",
+	Sent:    "sent",
+	Failed:  "failed",
+}
+
+const (
+	defaultDigestHour   = 8
+	maxDeliveryAttempts = 5
+	maxDigestItems      = 100
+	// maxImmediateBatch bounds how many notifications one run emails so
+	// digests and sending are not held up by a burst.
+	maxImmediateBatch = 500
+)
+
+// NotificationPreferences is how a user wants to be emailed. Channels maps a
+// channel id in hex to a delivery mode, channels not listed use DefaultMode.
+// No email is sent between QuietHoursStart and QuietHoursEnd, in the user's
+// time zone, unless both are equal.
+type NotificationPreferences struct {
+	User            primitive.ObjectID `bson:"_id" json:"user"`
+	DefaultMode     string             `bson:"defaultMode" json:"defaultMode"`
+	Channels        map[string]string  `bson:"channels" json:"channels"`
+	QuietHoursStart int                `bson:"quietHoursStart" json:"quietHoursStart"`
+	QuietHoursEnd   int                `bson:"quietHoursEnd" json:"quietHoursEnd"`
+	TimeZone        string             `bson:"timeZone" json:"timeZone"`
+	DigestHour      int                `bson:"digestHour" json:"digestHour"`
+	LastDigestAt    time.Time          `bson:"lastDigestAt" json:"lastDigestAt"`
+}
+
+func defaultNotificationPreferences(userID primitive.ObjectID) NotificationPreferences {
+	return NotificationPreferences{
+		User:        userID,
+		DefaultMode: DeliveryMode.InApp,
+		Channels:    map[string]string{},
+		TimeZone:    "UTC",
+		DigestHour:  defaultDigestHour,
+	}
+}
+
+// ModeFor returns the delivery mode of a channel.
+func (p NotificationPreferences) ModeFor(channel primitive.ObjectID) string {
+	if mode, ok := p.Channels[channel.Hex()]; ok {
+		return mode
+	}
+	return p.DefaultMode
+}
+
+func (p NotificationPreferences) location() *time.Location {
+	loc, err := time.LoadLocation(p.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// QuietUntil returns when the quiet hours covering t end, or t itself when t
+// is outside them.
+func (p NotificationPreferences) QuietUntil(t time.Time) time.Time {
+	if p.QuietHoursStart == p.QuietHoursEnd {
+		return t
+	}
+	local := t.In(p.location())
+	hour := local.Hour()
+	quiet := false
+	if p.QuietHoursStart < p.QuietHoursEnd {
+		quiet = hour >= p.QuietHoursStart && hour < p.QuietHoursEnd
+	} else {
+		// quiet hours spanning midnight, such as 22 to 7
+		quiet = hour >= p.QuietHoursStart || hour < p.QuietHoursEnd
+	}
+	if !quiet {
+		return t
+	}
+	end := time.Date(local.Year(), local.Month(), local.Day(), p.QuietHoursEnd, 0, 0, 0, local.Location())
+	if !end.After(local) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return end
+}
+
+func (p *NotificationPreferences) validate() error {
+	if !IsValidDeliveryMode(p.DefaultMode) {
+		return fmt.Errorf("invalid delivery mode %q", p.DefaultMode)
+	}
+	for channel, mode := range p.Channels {
+		if _, err := primitive.ObjectIDFromHex(channel); err != nil {
+			return fmt.Errorf("invalid channel %q", channel)
+		}
+		if !IsValidDeliveryMode(mode) {
+			return fmt.Errorf("invalid delivery mode %q", mode)
+		}
+	}
+	for _, hour := range []int{p.QuietHoursStart, p.QuietHoursEnd, p.DigestHour} {
+		if hour < 0 || hour > 23 {
+			return fmt.Errorf("hours must be between 0 and 23")
+		}
+	}
+	if _, err := time.LoadLocation(p.TimeZone); err != nil {
+		return fmt.Errorf("invalid time zone")
+	}
+	return nil
+}
+
+func GetNotificationPreferences(userID primitive.ObjectID) (NotificationPreferences, error) {
+	prefs := defaultNotificationPreferences(userID)
+	collection := GetCollection("notificationprefs")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := collection.FindOne(ctx, bson.M{"_id": userID}).Decode(&prefs)
+	if err == mongo.ErrNoDocuments {
+		return prefs, nil
+	}
+	if prefs.Channels == nil {
+		prefs.Channels = map[string]string{}
+	}
+	return prefs, err
+}
+
+// SetNotificationPreferences replaces the user's preferences. The time of
+// the last digest is kept.
+func SetNotificationPreferences(prefs NotificationPreferences) error {
+	if prefs.Channels == nil {
+		prefs.Channels = map[string]string{}
+	}
+	if prefs.TimeZone == "" {
+		prefs.TimeZone = "UTC"
+	}
+	if err := prefs.validate(); err != nil {
+		return err
+	}
+	collection := GetCollection("notificationprefs")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{
+		"defaultMode":     prefs.DefaultMode,
+		"channels":        prefs.Channels,
+		"quietHoursStart": prefs.QuietHoursStart,
+		"quietHoursEnd":   prefs.QuietHoursEnd,
+		"timeZone":        prefs.TimeZone,
+		"digestHour":      prefs.DigestHour,
+	}, "$setOnInsert": bson.M{"lastDigestAt": time.Now()}}
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": prefs.User}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+// EmailDelivery is an email sent, or to be sent, to a user. The notifications
+// are copied so the email can still be sent after they are purged.
+type EmailDelivery struct {
+	ID        primitive.ObjectID     `bson:"_id,omitempty" json:"id"`
+	User      primitive.ObjectID     `bson:"user" json:"user"`
+	Email     string                 `bson:"email" json:"email"`
+	Kind      string                 `bson:"kind" json:"kind"`
+	Items     []helpers.Notification `bson:"items" json:"items"`
+	Status    string                 `bson:"status" json:"status"`
+	Attempts  int                    `bson:"attempts" json:"attempts"`
+	Error     string                 `bson:"error,omitempty" json:"error,omitempty"`
+	SendAfter time.Time              `bson:"sendAfter" json:"sendAfter"`
+	CreatedAt time.Time              `bson:"createdAt" json:"createdAt"`
+	SentAt    time.Time              `bson:"sentAt,omitempty" json:"sentAt,omitempty"`
+}
+
+func queueEmailDelivery(ctx context.Context, delivery EmailDelivery) error {
+	delivery.ID = primitive.NewObjectID()
+	delivery.Status = DeliveryStatus.Pending
+	delivery.CreatedAt = time.Now()
+	_, err := GetCollection("emaildeliveries").InsertOne(ctx, delivery)
+	return err
+}
+
+// GetEmailDeliveries returns the user's most recent emails.
+func GetEmailDeliveries(userID primitive.ObjectID, limit int64) ([]EmailDelivery, error) {
+	deliveries := []EmailDelivery{}
+	collection := GetCollection("emaildeliveries")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"_id": -1}).SetLimit(limit)
+	cursor, err := collection.Find(ctx, bson.M{"user": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var delivery EmailDelivery
+		if err := cursor.Decode(&delivery); err != nil {
+			continue
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+// QueueImmediateEmails queues an email for every notification still marked
+// pending to the subscribers who asked for immediate delivery. Each
+// notification is claimed by clearing its mark, so it is handled once across
+// restarts and instances whatever order notifications are committed in.
+func QueueImmediateEmails() error {
+	collection := GetCollection("notifications")
+	opts := options.FindOneAndUpdate().SetSort(bson.M{"_id": 1})
+	for i := 0; i < maxImmediateBatch; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		var notification helpers.Notification
+		err := collection.FindOneAndUpdate(ctx, bson.M{"emailPending": true}, bson.M{"$unset": bson.M{"emailPending": ""}}, opts).Decode(&notification)
+		if err == mongo.ErrNoDocuments {
+			cancel()
+			return nil
+		}
+		if err != nil {
+			cancel()
+			return err
+		}
+		queueImmediateEmails(ctx, notification)
+		cancel()
+	}
+	return nil
+}
+
+func queueImmediateEmails(ctx context.Context, notification helpers.Notification) {
+	recipients, err := immediateRecipients(ctx, notification.ObjectID)
+	if err != nil {
+		log.Printf("Failed to find email recipients of notification %s: %v", notification.ID.Hex(), err)
+		return
+	}
+	for _, recipient := range recipients {
+		delivery := EmailDelivery{
+			User:      recipient.user.ID,
+			Email:     recipient.user.Email,
+			Kind:      DeliveryMode.Immediate,
+			Items:     []helpers.Notification{notification},
+			SendAfter: recipient.prefs.QuietUntil(time.Now()),
+		}
+		if err := queueEmailDelivery(ctx, delivery); err != nil {
+			log.Printf("Failed to queue email for %s: %v", recipient.user.ID.Hex(), err)
+		}
+	}
+}
+
+type emailRecipient struct {
+	user  User
+	prefs NotificationPreferences
+}
+
+// immediateRecipients returns the users receiving a channel who want its
+// notifications emailed right away.
+func immediateRecipients(ctx context.Context, channel primitive.ObjectID) ([]emailRecipient, error) {
+	key := "channels." + channel.Hex()
+	filter := bson.M{"$or": []bson.M{
+		{key: DeliveryMode.Immediate},
+		{key: bson.M{"$exists": false}, "defaultMode": DeliveryMode.Immediate},
+	}}
+	cursor, err := GetCollection("notificationprefs").Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	prefs := map[primitive.ObjectID]NotificationPreferences{}
+	ids := []primitive.ObjectID{}
+	for cursor.Next(ctx) {
+		var p NotificationPreferences
+		if err := cursor.Decode(&p); err != nil {
+			continue
+		}
+		prefs[p.User] = p
+		ids = append(ids, p.User)
+	}
+	cursor.Close(ctx)
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	receivers := []bson.M{{"notificationsubs": channel}, {"_id": channel}}
+	if tribune, err := GetTribuneByID(channel); err == nil {
+		receivers = append(receivers, bson.M{"_id": bson.M{"$in": append(tribune.Maintainers, tribune.Members...)}})
+	}
+	userFilter := bson.M{"_id": bson.M{"$in": ids}, "$or": receivers}
+	cursor, err = GetCollection("users").Find(ctx, userFilter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var recipients []emailRecipient
+	for cursor.Next(ctx) {
+		var user User
+		if err := cursor.Decode(&user); err != nil || user.Email == "" {
+			continue
+		}
+		recipients = append(recipients, emailRecipient{user: user, prefs: prefs[user.ID]})
+	}
+	return recipients, nil
+}
+
+// QueueDigests queues the daily digest of every user whose digest hour has
+// passed today and who has not had one since.
+func QueueDigests() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	filter := bson.M{"$or": []bson.M{
+		{"defaultMode": DeliveryMode.Digest},
+		{"$expr": bson.M{"$in": bson.A{DeliveryMode.Digest, bson.M{"$map": bson.M{
+			"input": bson.M{"$objectToArray": bson.M{"$ifNull": bson.A{"$channels", bson.M{}}}},
+			"in":    "$$this.v",
+		}}}}},
+	}}
+	cursor, err := GetCollection("notificationprefs").Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	var all []NotificationPreferences
+	if err := cursor.All(ctx, &all); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, prefs := range all {
+		local := now.In(prefs.location())
+		due := time.Date(local.Year(), local.Month(), local.Day(), prefs.DigestHour, 0, 0, 0, local.Location())
+		if local.Before(due) || !prefs.LastDigestAt.Before(due) {
+			continue
+		}
+		if err := queueDigest(ctx, prefs, due, now); err != nil {
+			log.Printf("Failed to queue digest for %s: %v", prefs.User.Hex(), err)
+		}
+	}
+	return nil
+}
+
+func queueDigest(ctx context.Context, prefs NotificationPreferences, due time.Time, now time.Time) error {
+	// claim the digest so it is queued once even with several instances
+	claim := bson.M{"_id": prefs.User, "lastDigestAt": prefs.LastDigestAt}
+	claimed, err := GetCollection("notificationprefs").UpdateOne(ctx, claim, bson.M{"$set": bson.M{"lastDigestAt": now}})
+	if err != nil || claimed.ModifiedCount == 0 {
+		return err
+	}
+
+	user, err := GetUserByID(prefs.User)
+	if err != nil || user.Email == "" {
+		return err
+	}
+	channels, err := GetUserNotificationChannels(user.ID)
+	if err != nil {
+		return err
+	}
+	var digestChannels []primitive.ObjectID
+	for _, channel := range channels {
+		if prefs.ModeFor(channel) == DeliveryMode.Digest {
+			digestChannels = append(digestChannels, channel)
+		}
+	}
+	if len(digestChannels) == 0 {
+		return nil
+	}
+
+	since := prefs.LastDigestAt
+	if since.IsZero() || since.Before(now.AddDate(0, 0, -1)) {
+		since = now.AddDate(0, 0, -1)
+	}
+	filter := bson.M{
+		"channel": bson.M{"$in": digestChannels},
+		"_id":     bson.M{"$gt": primitive.NewObjectIDFromTimestamp(since)},
+	}
+	opts := options.Find().SetSort(bson.M{"_id": 1}).SetLimit(maxDigestItems)
+	cursor, err := GetCollection("notifications").Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	var items []helpers.Notification
+	if err := cursor.All(ctx, &items); err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	return queueEmailDelivery(ctx, EmailDelivery{
+		User:      user.ID,
+		Email:     user.Email,
+		Kind:      DeliveryMode.Digest,
+		Items:     items,
+		SendAfter: prefs.QuietUntil(now),
+	})
+}
+
+// SendDueEmails sends the queued emails whose time has come. Failed sends are
+// retried with a growing delay and given up after a few attempts.
+func SendDueEmails(sender helpers.Sender) error {
+	collection := GetCollection("emaildeliveries")
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		var delivery EmailDelivery
+		// a delivery left sending by an instance that stopped is picked up
+		// again once its claim expires
+		filter := bson.M{
+			"status":    bson.M{"$in": []string{DeliveryStatus.Pending, DeliveryStatus.Sending}},
+			"sendAfter": bson.M{"$lte": time.Now()},
+		}
+		update := bson.M{
+			"$set": bson.M{"status": DeliveryStatus.Sending, "sendAfter": time.Now().Add(10 * time.Minute)},
+			"$inc": bson.M{"attempts": 1},
+		}
+		opts := options.FindOneAndUpdate().SetSort(bson.M{"sendAfter": 1}).SetReturnDocument(options.After)
+		err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&delivery)
+		if err == mongo.ErrNoDocuments {
+			cancel()
+			return nil
+		}
+		if err != nil {
+			cancel()
+			return err
+		}
+
+		result := bson.M{"status": DeliveryStatus.Sent, "sentAt": time.Now()}
+		if err := sendDelivery(sender, delivery); err != nil {
+			result = bson.M{"status": DeliveryStatus.Failed, "error": err.Error()}
+			if delivery.Attempts < maxDeliveryAttempts {
+				result["status"] = DeliveryStatus.Pending
+				result["sendAfter"] = time.Now().Add(time.Duration(delivery.Attempts*delivery.Attempts) * time.Minute)
+			}
+		}
+		collection.UpdateByID(ctx, delivery.ID, bson.M{"$set": result})
+		cancel()
+	}
+}
+
+func sendDelivery(sender helpers.Sender, delivery EmailDelivery) error {
+	user, err := GetUserByID(delivery.User)
+	if err != nil {
+		return err
+	}
+	subject := delivery.Items[0].Message
+	title := "New notification"
+	if delivery.Kind == DeliveryMode.Digest {
+		subject = fmt.Sprintf("Your Hermes digest: %d new notifications", len(delivery.Items))
+		title = "Your daily digest"
+	} else if runes := []rune(subject); len(runes) > 80 {
+		subject = string(runes[:77]) + "..."
+	}
+	return sender.Send(delivery.Email, subject, "notifications", helpers.NotificationEmail{
+		Title: title,
+		Name:  user.Name,
+		Items: delivery.Items,
+	})
+}
+
+// StartEmailDelivery queues and sends notification emails every interval.
+func StartEmailDelivery(sender helpers.Sender, interval time.Duration) {
+	go func() {
+		for {
+			if err := QueueImmediateEmails(); err != nil {
+				log.Printf("Failed to queue notification emails: %v", err)
+			}
+			if err := QueueDigests(); err != nil {
+				log.Printf("Failed to queue digests: %v", err)
+			}
+			if err := SendDueEmails(sender); err != nil {
+				log.Printf("Failed to send notification emails: %v", err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
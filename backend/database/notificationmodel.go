@@ -0,0 +1,317 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hermes/helpers"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DefaultInboxPageSize         = 30
+	MaxInboxPageSize             = 100
+	defaultNotificationRetention = 90 * 24 * time.Hour
+)
+
+// InboxItem is a stored notification with the reader's read state.
+type InboxItem struct {
+	helpers.Notification `bson:",inline"`
+	Read                 bool `bson:"-" json:"read"`
+}
+
+type InboxPage struct {
+	Items   []InboxItem        `json:"items"`
+	Before  primitive.ObjectID `json:"before"`
+	After   primitive.ObjectID `json:"after"`
+	HasMore bool               `json:"hasMore"`
+	Unread  int64              `json:"unread"`
+}
+
+// inboxState is how far a user has read their inbox. Notifications up to
+// ReadUpTo are read, newer ones are read when listed in notificationreads.
+type inboxState struct {
+	User     primitive.ObjectID `bson:"_id"`
+	ReadUpTo primitive.ObjectID `bson:"readUpTo"`
+}
+
+// notificationStore saves notifications to the inbox. With emails enabled
+// they are marked pending until the email worker has queued their emails.
+type notificationStore struct {
+	emails bool
+}
+
+// storedNotification is a notification as kept in the notifications
+// collection.
+type storedNotification struct {
+	helpers.Notification `bson:",inline"`
+	EmailPending         bool `bson:"emailPending,omitempty"`
+}
+
+func (store notificationStore) SaveNotification(notification *helpers.Notification) error {
+	collection := GetCollection("notifications")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if notification.ID.IsZero() {
+		notification.ID = primitive.NewObjectID()
+	}
+	seq, err := nextNotificationSeq(ctx)
+	if err != nil {
+		return err
+	}
+	notification.Seq = seq
+	_, err = collection.InsertOne(ctx, storedNotification{Notification: *notification, EmailPending: store.emails})
+	return err
+}
+
+// nextNotificationSeq takes the next number of the notification sequence.
+// ObjectIDs are only ordered to the second and per instance, so streams
+// resume from the sequence instead.
+func nextNotificationSeq(ctx context.Context) (int64, error) {
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	update := bson.M{"$inc": bson.M{"seq": int64(1)}}
+	err := GetCollection("counters").FindOneAndUpdate(ctx, bson.M{"_id": "notifications"}, update, opts).Decode(&counter)
+	return counter.Seq, err
+}
+
+// readState returns the user's read watermark and the notifications read
+// individually after it.
+func readState(ctx context.Context, userID primitive.ObjectID) (primitive.ObjectID, []primitive.ObjectID, error) {
+	var state inboxState
+	err := GetCollection("inboxstates").FindOne(ctx, bson.M{"_id": userID}).Decode(&state)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return state.ReadUpTo, nil, err
+	}
+
+	read := []primitive.ObjectID{}
+	filter := bson.M{"user": userID, "notification": bson.M{"$gt": state.ReadUpTo}}
+	cursor, err := GetCollection("notificationreads").Find(ctx, filter)
+	if err != nil {
+		return state.ReadUpTo, nil, err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var entry struct {
+			Notification primitive.ObjectID `bson:"notification"`
+		}
+		if err := cursor.Decode(&entry); err != nil {
+			continue
+		}
+		read = append(read, entry.Notification)
+	}
+	return state.ReadUpTo, read, cursor.Err()
+}
+
+func unreadFilter(channels []primitive.ObjectID, readUpTo primitive.ObjectID, read []primitive.ObjectID) bson.M {
+	return bson.M{
+		"channel": bson.M{"$in": channels},
+		"_id":     bson.M{"$gt": readUpTo, "$nin": read},
+	}
+}
+
+// GetInbox pages through the notifications of the user's channels, newest
+// first, the same way GetTribuneMessages pages through a tribune.
+func GetInbox(userID primitive.ObjectID, channels []primitive.ObjectID, before, after primitive.ObjectID, limit int64, unreadOnly bool) (InboxPage, error) {
+	page := InboxPage{Items: []InboxItem{}}
+	if limit <= 0 || limit > MaxInboxPageSize {
+		limit = DefaultInboxPageSize
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	readUpTo, read, err := readState(ctx, userID)
+	if err != nil {
+		return page, err
+	}
+	isRead := map[primitive.ObjectID]bool{}
+	for _, id := range read {
+		isRead[id] = true
+	}
+
+	filter := bson.M{"channel": bson.M{"$in": channels}}
+	idFilter := bson.M{}
+	var lower primitive.ObjectID
+	if unreadOnly {
+		lower = readUpTo
+		idFilter["$nin"] = read
+	}
+	sort := -1
+	if !before.IsZero() {
+		idFilter["$lt"] = before
+	} else if !after.IsZero() {
+		if bytes.Compare(after[:], lower[:]) > 0 {
+			lower = after
+		}
+		sort = 1
+	}
+	if !lower.IsZero() {
+		idFilter["$gt"] = lower
+	}
+	if len(idFilter) > 0 {
+		filter["_id"] = idFilter
+	}
+
+	collection := GetCollection("notifications")
+	opts := options.Find().SetSort(bson.M{"_id": sort}).SetLimit(limit + 1)
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return page, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var item InboxItem
+		if err := cursor.Decode(&item); err != nil {
+			continue
+		}
+		item.Read = bytes.Compare(item.ID[:], readUpTo[:]) <= 0 || isRead[item.ID]
+		page.Items = append(page.Items, item)
+	}
+	if err := cursor.Err(); err != nil {
+		return page, err
+	}
+
+	if int64(len(page.Items)) > limit {
+		page.HasMore = true
+		page.Items = page.Items[:limit]
+	}
+	if sort == 1 {
+		for i, j := 0, len(page.Items)-1; i < j; i, j = i+1, j-1 {
+			page.Items[i], page.Items[j] = page.Items[j], page.Items[i]
+		}
+	}
+	if len(page.Items) > 0 {
+		page.After = page.Items[0].ID
+		page.Before = page.Items[len(page.Items)-1].ID
+	}
+
+	page.Unread, err = collection.CountDocuments(ctx, unreadFilter(channels, readUpTo, read))
+	return page, err
+}
+
+// GetNotificationsSince returns the notifications of the channels stored
+// after the given sequence number, oldest first.
+func GetNotificationsSince(channels []primitive.ObjectID, after int64, limit int64) ([]helpers.Notification, error) {
+	var notifications []helpers.Notification
+	collection := GetCollection("notifications")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"channel": bson.M{"$in": channels}, "seq": bson.M{"$gt": after}}
+	opts := options.Find().SetSort(bson.M{"seq": 1}).SetLimit(limit)
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var notification helpers.Notification
+		if err := cursor.Decode(&notification); err != nil {
+			continue
+		}
+		notifications = append(notifications, notification)
+	}
+	return notifications, cursor.Err()
+}
+
+// GetUnreadNotificationCount counts the unread notifications of the user's
+// channels.
+func GetUnreadNotificationCount(userID primitive.ObjectID, channels []primitive.ObjectID) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	readUpTo, read, err := readState(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	return GetCollection("notifications").CountDocuments(ctx, unreadFilter(channels, readUpTo, read))
+}
+
+// MarkNotificationRead marks a single notification of the user's channels as
+// read.
+func MarkNotificationRead(userID primitive.ObjectID, channels []primitive.ObjectID, id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	count, err := GetCollection("notifications").CountDocuments(ctx, bson.M{"_id": id, "channel": bson.M{"$in": channels}})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("notification not found")
+	}
+
+	filter := bson.M{"user": userID, "notification": id}
+	update := bson.M{"$setOnInsert": bson.M{"time": id.Timestamp()}}
+	_, err = GetCollection("notificationreads").UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+// MarkAllNotificationsRead moves the user's watermark past every existing
+// notification and drops the individual read marks it covers.
+func MarkAllNotificationsRead(userID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	readUpTo := primitive.NewObjectID()
+	update := bson.M{"$max": bson.M{"readUpTo": readUpTo}}
+	_, err := GetCollection("inboxstates").UpdateOne(ctx, bson.M{"_id": userID}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+	_, err = GetCollection("notificationreads").DeleteMany(ctx, bson.M{"user": userID, "notification": bson.M{"$lte": readUpTo}})
+	return err
+}
+
+// PurgeNotifications deletes notifications older than the retention period
+// together with their read marks.
+func PurgeNotifications(retention time.Duration) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	cutoff := primitive.NewObjectIDFromTimestamp(time.Now().Add(-retention))
+	result, err := GetCollection("notifications").DeleteMany(ctx, bson.M{"_id": bson.M{"$lt": cutoff}})
+	if err != nil {
+		return 0, err
+	}
+	_, err = GetCollection("notificationreads").DeleteMany(ctx, bson.M{"notification": bson.M{"$lt": cutoff}})
+	return result.DeletedCount, err
+}
+
+// NotificationRetention reads NOTIFICATION_RETENTION_DAYS, defaulting to 90
+// days.
+func NotificationRetention() time.Duration {
+	if days, err := strconv.Atoi(os.Getenv("NOTIFICATION_RETENTION_DAYS")); err == nil && days > 0 {
+		return time.Duration(days) * 24 * time.Hour
+	}
+	return defaultNotificationRetention
+}
+
+// StartNotificationCleanup purges expired notifications now and then every
+// interval.
+func StartNotificationCleanup(interval time.Duration) {
+	go func() {
+		for {
+			purged, err := PurgeNotifications(NotificationRetention())
+			if err != nil {
+				log.Printf("Failed to purge notifications: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d expired notifications", purged)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
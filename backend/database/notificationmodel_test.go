@@ -0,0 +1,64 @@
+package database
+
+import (
+	"hermes/helpers"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestNotificationSequence(t *testing.T) {
+	t.Setenv("MONGO_DATABASE", "hermes")
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	channel := primitive.NewObjectID()
+
+	mt.Run("save", func(mt *mtest.T) {
+		useMockDatabase(mt)
+		mt.AddMockResponses(
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: bson.D{{Key: "_id", Value: "notifications"}, {Key: "seq", Value: int64(42)}}}},
+			mtest.CreateSuccessResponse(),
+		)
+
+		notification := helpers.Notification{ObjectID: channel, Message: "hello"}
+		if err := (notificationStore{}).SaveNotification(&notification); err != nil {
+			mt.Fatal(err)
+		}
+		if notification.Seq != 42 {
+			mt.Fatalf("notification got sequence %d, want 42", notification.Seq)
+		}
+
+		counter := mt.GetStartedEvent()
+		if counter.CommandName != "findAndModify" || counter.Command.Lookup("findAndModify").StringValue() != "counters" {
+			mt.Fatalf("sequence was not taken from the counter: %s", counter.Command)
+		}
+		insert := mt.GetStartedEvent()
+		if seq := insert.Command.Lookup("documents").Array().Index(0).Value().Document().Lookup("seq"); seq.Int64() != 42 {
+			mt.Fatalf("stored notification has sequence %v", seq)
+		}
+	})
+
+	mt.Run("replay", func(mt *mtest.T) {
+		useMockDatabase(mt)
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "hermes.notifications", mtest.FirstBatch,
+			bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "channel", Value: channel}, {Key: "seq", Value: int64(8)}},
+		))
+
+		missed, err := GetNotificationsSince([]primitive.ObjectID{channel}, 7, 10)
+		if err != nil {
+			mt.Fatal(err)
+		}
+		if len(missed) != 1 || missed[0].Seq != 8 {
+			mt.Fatalf("unexpected replay: %+v", missed)
+		}
+
+		command := mt.GetStartedEvent().Command
+		if after := command.Lookup("filter", "seq", "$gt"); after.Int64() != 7 {
+			mt.Fatalf("replay is not filtered by sequence: %s", command.Lookup("filter"))
+		}
+		if order := command.Lookup("sort", "seq"); order.Int32() != 1 {
+			mt.Fatalf("replay is not sorted by sequence: %s", command.Lookup("sort"))
+		}
+	})
+}
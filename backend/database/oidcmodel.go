@@ -0,0 +1,49 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// OIDCLoginState is kept between the redirect to the identity provider and
+// its callback so the authorization code can be redeemed with PKCE.
+type OIDCLoginState struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty"`
+	State        string             `bson:"state"`
+	Nonce        string             `bson:"nonce"`
+	CodeVerifier string             `bson:"codeVerifier"`
+	ExpiresAt    time.Time          `bson:"expiresAt"`
+}
+
+func CreateOIDCLoginState(state OIDCLoginState) (*mongo.InsertOneResult, error) {
+	collection := GetCollection("oidcstate")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return collection.InsertOne(ctx, state)
+}
+
+// ConsumeOIDCLoginState returns the stored login state and deletes it so the
+// same state value can never be redeemed twice.
+func ConsumeOIDCLoginState(state string) (OIDCLoginState, error) {
+	var loginState OIDCLoginState
+	collection := GetCollection("oidcstate")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := collection.FindOneAndDelete(ctx, bson.M{"state": state}).Decode(&loginState)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return loginState, fmt.Errorf("unknown login state")
+		}
+		return loginState, err
+	}
+	if time.Now().After(loginState.ExpiresAt) {
+		return loginState, fmt.Errorf("login state expired")
+	}
+	return loginState, nil
+}
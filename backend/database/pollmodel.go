@@ -0,0 +1,229 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GetPoll loads a poll message.
+func GetPoll(id primitive.ObjectID) (*Poll, error) {
+	message, err := GetMessageByID(id)
+	if err != nil {
+		return nil, err
+	}
+	poll, ok := message.(*Poll)
+	if !ok || poll.Deleted {
+		return nil, fmt.Errorf("poll not found")
+	}
+	return poll, nil
+}
+
+// VotePoll replaces the user's votes on a poll with the chosen options.
+func VotePoll(poll *Poll, userID primitive.ObjectID, optionIDs []primitive.ObjectID) error {
+	if poll.IsClosed(time.Now()) {
+		return fmt.Errorf("poll is closed")
+	}
+	if len(optionIDs) == 0 {
+		return fmt.Errorf("choose at least one option")
+	}
+	if len(optionIDs) > 1 && !poll.MultipleChoice {
+		return fmt.Errorf("poll allows a single choice")
+	}
+	known := map[primitive.ObjectID]bool{}
+	for _, option := range poll.Options {
+		known[option.ID] = true
+	}
+	for _, optionID := range optionIDs {
+		if !known[optionID] {
+			return fmt.Errorf("unknown option")
+		}
+	}
+
+	collection := GetCollection("messages")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// the old votes are replaced in a single update so a poll closing in
+	// between cannot leave the user without a vote
+	votes := bson.M{"$ifNull": bson.A{"$$option.votes", bson.A{}}}
+	update := bson.A{bson.M{"$set": bson.M{"options": bson.M{"$map": bson.M{
+		"input": "$options",
+		"as":    "option",
+		"in": bson.M{"$mergeObjects": bson.A{"$$option", bson.M{"votes": bson.M{"$cond": bson.A{
+			bson.M{"$in": bson.A{"$$option._id", optionIDs}},
+			bson.M{"$setUnion": bson.A{votes, bson.A{userID}}},
+			bson.M{"$setDifference": bson.A{votes, bson.A{userID}}},
+		}}}}},
+	}}}}}
+	result, err := collection.UpdateOne(ctx, openPollFilter(poll.ID), update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("poll is closed")
+	}
+	return nil
+}
+
+// RetractPollVote removes the user's votes from every option of a poll.
+func RetractPollVote(poll *Poll, userID primitive.ObjectID) error {
+	if poll.IsClosed(time.Now()) {
+		return fmt.Errorf("poll is closed")
+	}
+	collection := GetCollection("messages")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"$pull": bson.M{"options.$[].votes": userID}}
+	result, err := collection.UpdateOne(ctx, openPollFilter(poll.ID), update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("poll is closed")
+	}
+	return nil
+}
+
+func openPollFilter(id primitive.ObjectID) bson.M {
+	return bson.M{
+		"_id":     id,
+		"deleted": bson.M{"$ne": true},
+		"$or": []bson.M{
+			{"closesAt": bson.M{"$exists": false}},
+			{"closesAt": bson.M{"$gt": primitive.NewDateTimeFromTime(time.Now())}},
+		},
+	}
+}
+
+// CloseMessageVoting closes a poll or quiz now.
+func CloseMessageVoting(id primitive.ObjectID) (*mongo.UpdateResult, error) {
+	collection := GetCollection("messages")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	update := bson.M{"$set": bson.M{"closesAt": primitive.NewDateTimeFromTime(time.Now())}}
+	return collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+}
+
+// QuizAnswer is the options a student chose for one question.
+type QuizAnswer struct {
+	Question primitive.ObjectID `bson:"question" json:"question"`
+	Choices  []int              `bson:"choices" json:"choices"`
+}
+
+// QuizAttempt is a student's graded answer sheet for a quiz.
+type QuizAttempt struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Quiz        primitive.ObjectID `bson:"quiz" json:"quiz"`
+	Tribune     primitive.ObjectID `bson:"tribune" json:"tribune"`
+	User        primitive.ObjectID `bson:"user" json:"user"`
+	Answers     []QuizAnswer       `bson:"answers" json:"answers"`
+	Score       float64            `bson:"score" json:"score"`
+	MaxScore    float64            `bson:"maxScore" json:"maxScore"`
+	SubmittedAt time.Time          `bson:"submittedAt" json:"submittedAt"`
+}
+
+// ScoreQuiz grades answers against the quiz's answer key. A question scores
+// its points only when exactly the correct options were chosen.
+func ScoreQuiz(quiz *Quiz, answers []QuizAnswer) (float64, error) {
+	chosen := map[primitive.ObjectID][]int{}
+	for _, answer := range answers {
+		if _, dup := chosen[answer.Question]; dup {
+			return 0, fmt.Errorf("question answered twice")
+		}
+		chosen[answer.Question] = answer.Choices
+	}
+
+	score := 0.0
+	for _, question := range quiz.Questions {
+		choices, ok := chosen[question.ID]
+		delete(chosen, question.ID)
+		if !ok {
+			continue
+		}
+		for _, choice := range choices {
+			if choice < 0 || choice >= len(question.Options) {
+				return 0, fmt.Errorf("invalid choice")
+			}
+		}
+		if sameChoices(choices, question.Correct) {
+			score += question.Points
+		}
+	}
+	if len(chosen) > 0 {
+		return 0, fmt.Errorf("unknown question")
+	}
+	return score, nil
+}
+
+func sameChoices(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	x := append([]int{}, a...)
+	y := append([]int{}, b...)
+	sort.Ints(x)
+	sort.Ints(y)
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// SubmitQuizAttempt stores a student's only attempt at a quiz.
+func SubmitQuizAttempt(attempt QuizAttempt) (*mongo.InsertOneResult, error) {
+	if attempt.ID.IsZero() {
+		attempt.ID = primitive.NewObjectID()
+	}
+	attempt.SubmittedAt = time.Now()
+
+	collection := GetCollection("quizattempts")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, err := collection.InsertOne(ctx, attempt)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, fmt.Errorf("you already answered this quiz")
+	}
+	return result, err
+}
+
+func GetQuizAttempt(quizID primitive.ObjectID, userID primitive.ObjectID) (QuizAttempt, error) {
+	var attempt QuizAttempt
+	collection := GetCollection("quizattempts")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := collection.FindOne(ctx, bson.M{"quiz": quizID, "user": userID}).Decode(&attempt)
+	return attempt, err
+}
+
+// GetQuizAttempts returns the attempts matching filter.
+func GetQuizAttempts(filter bson.M) ([]QuizAttempt, error) {
+	var attempts []QuizAttempt
+	collection := GetCollection("quizattempts")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(bson.M{"submittedAt": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var attempt QuizAttempt
+		if err := cursor.Decode(&attempt); err != nil {
+			continue
+		}
+		attempts = append(attempts, attempt)
+	}
+	return attempts, nil
+}
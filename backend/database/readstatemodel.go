@@ -0,0 +1,141 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ReadState is how far a user has read a tribune. Message ids grow with time,
+// so everything up to LastRead counts as read.
+type ReadState struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Tribune   primitive.ObjectID `bson:"tribune" json:"tribune"`
+	User      primitive.ObjectID `bson:"user" json:"user"`
+	LastRead  primitive.ObjectID `bson:"lastRead" json:"lastRead"`
+	UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// UnreadCount is the number of unread messages in a tribune and how many of
+// them mention the user.
+type UnreadCount struct {
+	Messages int `bson:"messages" json:"messages"`
+	Mentions int `bson:"mentions" json:"mentions"`
+}
+
+// MarkTribuneRead moves the user's read position forward to messageID. It
+// never moves backwards, so reading an old page does not mark newer messages
+// unread again.
+func MarkTribuneRead(tribuneID primitive.ObjectID, userID primitive.ObjectID, messageID primitive.ObjectID) (*mongo.UpdateResult, error) {
+	collection := GetCollection("readstates")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$max": bson.M{"lastRead": messageID},
+		"$set": bson.M{"updatedAt": time.Now()},
+	}
+	filter := bson.M{"tribune": tribuneID, "user": userID}
+	return collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+}
+
+// GetLatestMessageID returns the id of the newest message in a tribune.
+func GetLatestMessageID(tribuneID primitive.ObjectID) (primitive.ObjectID, error) {
+	var latest struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	collection := GetCollection("messages")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.FindOne().SetSort(bson.M{"_id": -1}).SetProjection(bson.M{"_id": 1})
+	err := collection.FindOne(ctx, bson.M{"tribune": tribuneID}, opts).Decode(&latest)
+	return latest.ID, err
+}
+
+func GetReadStates(userID primitive.ObjectID) (map[primitive.ObjectID]ReadState, error) {
+	states := map[primitive.ObjectID]ReadState{}
+	collection := GetCollection("readstates")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := collection.Find(ctx, bson.M{"user": userID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var state ReadState
+		if err := cursor.Decode(&state); err != nil {
+			continue
+		}
+		states[state.Tribune] = state
+	}
+	return states, nil
+}
+
+// GetUnreadCounts counts, for each tribune, the messages by other users
+// posted after the user's read position.
+func GetUnreadCounts(userID primitive.ObjectID, tribuneIDs []primitive.ObjectID) (map[primitive.ObjectID]UnreadCount, error) {
+	counts := map[primitive.ObjectID]UnreadCount{}
+	if len(tribuneIDs) == 0 {
+		return counts, nil
+	}
+	states, err := GetReadStates(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	unread := []bson.M{}
+	for _, tribuneID := range tribuneIDs {
+		clause := bson.M{"tribune": tribuneID}
+		if state, ok := states[tribuneID]; ok {
+			clause["_id"] = bson.M{"$gt": state.LastRead}
+		}
+		unread = append(unread, clause)
+	}
+
+	collection := GetCollection("messages")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"$or":     unread,
+			"user":    bson.M{"$ne": userID},
+			"deleted": bson.M{"$ne": true},
+			"hidden":  bson.M{"$ne": true},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      "$tribune",
+			"messages": bson.M{"$sum": 1},
+			"mentions": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$in": bson.A{userID, bson.M{"$ifNull": bson.A{"$mentions", bson.A{}}}}},
+				1,
+				0,
+			}}},
+		}}},
+	}
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var row struct {
+			Tribune     primitive.ObjectID `bson:"_id"`
+			UnreadCount `bson:",inline"`
+		}
+		if err := cursor.Decode(&row); err != nil {
+			continue
+		}
+		counts[row.Tribune] = row.UnreadCount
+	}
+	return counts, cursor.Err()
+}
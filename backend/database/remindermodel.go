@@ -0,0 +1,226 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"hermes/helpers"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var defaultReminderOffsets = []time.Duration{24 * time.Hour, time.Hour}
+
+// Reminder records that a deadline reminder was sent. The unique source, due
+// and offset key makes every reminder fire once, across instances and
+// restarts, while a moved deadline gets reminders of its own.
+type Reminder struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty"`
+	Source primitive.ObjectID `bson:"source"`
+	Kind   string             `bson:"kind"`
+	Due    time.Time          `bson:"due"`
+	Offset time.Duration      `bson:"offset"`
+	SentAt time.Time          `bson:"sentAt"`
+	// ExpiresAt lets the record go once the deadline has passed.
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+// ReminderOffsets reads REMINDER_OFFSETS, a comma separated list of durations
+// before a deadline such as "24h,1h", defaulting to 24 hours and 1 hour. The
+// offsets are returned from the smallest to the largest.
+func ReminderOffsets() []time.Duration {
+	var offsets []time.Duration
+	for _, part := range strings.Split(os.Getenv("REMINDER_OFFSETS"), ",") {
+		offset, err := time.ParseDuration(strings.TrimSpace(part))
+		if err != nil || offset <= 0 {
+			continue
+		}
+		offsets = append(offsets, offset)
+	}
+	if len(offsets) == 0 {
+		offsets = append(offsets, defaultReminderOffsets...)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	return offsets
+}
+
+// reminderOffset returns the offset a deadline due in left falls under: the
+// smallest one that is still ahead of it. After downtime only the most
+// urgent missed reminder is sent instead of all of them at once.
+func reminderOffset(offsets []time.Duration, left time.Duration) (time.Duration, bool) {
+	for _, offset := range offsets {
+		if left <= offset {
+			return offset, true
+		}
+	}
+	return 0, false
+}
+
+// claimReminder records a reminder and reports whether this call was the
+// one to record it.
+func claimReminder(source primitive.ObjectID, kind string, due time.Time, offset time.Duration) (bool, error) {
+	collection := GetCollection("reminders")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	reminder := Reminder{
+		ID:        primitive.NewObjectID(),
+		Source:    source,
+		Kind:      kind,
+		Due:       due,
+		Offset:    offset,
+		SentAt:    time.Now(),
+		ExpiresAt: due,
+	}
+	_, err := collection.InsertOne(ctx, reminder)
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// formatTimeLeft rounds the time left before a deadline to hours, or to
+// minutes in the last hour.
+func formatTimeLeft(left time.Duration) string {
+	if left >= 55*time.Minute {
+		return fmt.Sprintf("%dh", int(left.Round(time.Hour).Hours()))
+	}
+	return fmt.Sprintf("%dm", int(left.Round(time.Minute).Minutes()))
+}
+
+// SendAssignmentReminders reminds the members of a tribune who have not
+// submitted yet of its upcoming assignment deadlines.
+func SendAssignmentReminders(offsets []time.Duration) error {
+	now := time.Now()
+	filter := bson.M{
+		"kind":     MessageKind.Assignment,
+		"deleted":  bson.M{"$ne": true},
+		"hidden":   bson.M{"$ne": true},
+		"deadline": bson.M{"$gt": primitive.NewDateTimeFromTime(now), "$lte": primitive.NewDateTimeFromTime(now.Add(offsets[len(offsets)-1]))},
+	}
+
+	collection := GetCollection("messages")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var assignment Assignment
+		if err := cursor.Decode(&assignment); err != nil {
+			continue
+		}
+		due := assignment.DeadLine.Time()
+		offset, ok := reminderOffset(offsets, due.Sub(now))
+		if !ok {
+			continue
+		}
+		claimed, err := claimReminder(assignment.ID, MessageKind.Assignment, due, offset)
+		if err != nil {
+			log.Printf("Failed to record reminder for assignment %s: %v", assignment.ID.Hex(), err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		tribune, err := GetTribuneByID(assignment.Tribune)
+		if err != nil {
+			continue
+		}
+		submitted, err := submittedUsers(assignment.ID)
+		if err != nil {
+			log.Printf("Failed to look up submissions for assignment %s: %v", assignment.ID.Hex(), err)
+		}
+		for _, member := range tribune.Members {
+			if submitted[member] {
+				continue
+			}
+			helpers.SendNotification(member, "", "Assignment due in %s in %s: %s", formatTimeLeft(due.Sub(now)), tribune.Name, gradebookTitle(assignment.Content))
+		}
+	}
+	return nil
+}
+
+// submittedUsers returns the users who have handed in an assignment.
+func submittedUsers(assignmentID primitive.ObjectID) (map[primitive.ObjectID]bool, error) {
+	collection := GetCollection("submissions")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	users, err := collection.Distinct(ctx, "user", bson.M{"assignment": assignmentID})
+	if err != nil {
+		return nil, err
+	}
+	submitted := make(map[primitive.ObjectID]bool, len(users))
+	for _, user := range users {
+		if id, ok := user.(primitive.ObjectID); ok {
+			submitted[id] = true
+		}
+	}
+	return submitted, nil
+}
+
+// SendTaskReminders reminds users of their unfinished tasks that are due
+// soon.
+func SendTaskReminders(offsets []time.Duration) error {
+	now := time.Now()
+	filter := bson.M{
+		"is_done":  false,
+		"due_date": bson.M{"$gt": primitive.NewDateTimeFromTime(now), "$lte": primitive.NewDateTimeFromTime(now.Add(offsets[len(offsets)-1]))},
+	}
+
+	collection := GetCollection("task")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var task Task
+		if err := cursor.Decode(&task); err != nil {
+			continue
+		}
+		due := task.DueDate.Time()
+		offset, ok := reminderOffset(offsets, due.Sub(now))
+		if !ok {
+			continue
+		}
+		claimed, err := claimReminder(task.ID, "task", due, offset)
+		if err != nil {
+			log.Printf("Failed to record reminder for task %s: %v", task.ID.Hex(), err)
+			continue
+		}
+		if claimed {
+			helpers.SendNotification(task.User, "", "Task due in %s: %s", formatTimeLeft(due.Sub(now)), task.Title)
+		}
+	}
+	return nil
+}
+
+// StartReminders sends deadline reminders every interval.
+func StartReminders(interval time.Duration) {
+	go func() {
+		for {
+			offsets := ReminderOffsets()
+			if err := SendAssignmentReminders(offsets); err != nil {
+				log.Printf("Failed to send assignment reminders: %v", err)
+			}
+			if err := SendTaskReminders(offsets); err != nil {
+				log.Printf("Failed to send task reminders: %v", err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
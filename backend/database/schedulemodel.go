@@ -0,0 +1,278 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"hermes/helpers"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ScheduleStatuses struct {
+	Scheduled string
+	Completed string
+	Cancelled string
+}
+
+var ScheduleStatus = ScheduleStatuses{
+	Scheduled: "scheduled",
+	Completed: "completed",
+	Cancelled: "cancelled",
+}
+
+// Recurrence is the subset of iCalendar RRULE scheduled announcements support, such
+// as "FREQ=WEEKLY;INTERVAL=2;COUNT=6" or "FREQ=DAILY;UNTIL=20250601T000000Z".
+type Recurrence struct {
+	Freq     string
+	Interval int
+	Count    int
+	Until    time.Time
+}
+
+// ParseRecurrence parses an RRULE with FREQ (DAILY, WEEKLY or MONTHLY) and
+// optional INTERVAL, COUNT and UNTIL.
+func ParseRecurrence(rule string) (Recurrence, error) {
+	r := Recurrence{Interval: 1}
+	for _, part := range strings.Split(strings.TrimPrefix(strings.TrimSpace(rule), "RRULE:"), ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return r, fmt.Errorf("invalid recurrence %q", part)
+		}
+		var err error
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			r.Freq = strings.ToUpper(value)
+			if r.Freq != "DAILY" && r.Freq != "WEEKLY" && r.Freq != "MONTHLY" {
+				return r, fmt.Errorf("unsupported frequency %q", value)
+			}
+		case "INTERVAL":
+			if r.Interval, err = strconv.Atoi(value); err != nil || r.Interval < 1 {
+				return r, fmt.Errorf("invalid interval")
+			}
+		case "COUNT":
+			if r.Count, err = strconv.Atoi(value); err != nil || r.Count < 1 {
+				return r, fmt.Errorf("invalid count")
+			}
+		case "UNTIL":
+			if r.Until, err = time.Parse("20060102T150405Z", value); err != nil {
+				return r, fmt.Errorf("invalid until, use YYYYMMDDTHHMMSSZ")
+			}
+		default:
+			return r, fmt.Errorf("unsupported recurrence part %q", key)
+		}
+	}
+	if r.Freq == "" {
+		return r, fmt.Errorf("recurrence needs a FREQ")
+	}
+	return r, nil
+}
+
+// after returns the occurrence n steps after start.
+func (r Recurrence) after(start time.Time, n int) time.Time {
+	switch r.Freq {
+	case "WEEKLY":
+		return start.AddDate(0, 0, 7*r.Interval*n)
+	case "MONTHLY":
+		return start.AddDate(0, r.Interval*n, 0)
+	default:
+		return start.AddDate(0, 0, r.Interval*n)
+	}
+}
+
+// ScheduledAnnouncement is a notification queued to be sent to channels at SendAt
+// and, with a recurrence, again at every following occurrence.
+type ScheduledAnnouncement struct {
+	ID         primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Channels   []primitive.ObjectID `bson:"channels" json:"channels"`
+	Message    string               `bson:"message" json:"message"`
+	Author     string               `bson:"author" json:"author"`
+	CreatedBy  primitive.ObjectID   `bson:"createdBy" json:"createdBy"`
+	StartAt    time.Time            `bson:"startAt" json:"startAt"`
+	SendAt     time.Time            `bson:"sendAt" json:"sendAt"`
+	Recurrence string               `bson:"recurrence,omitempty" json:"recurrence,omitempty"`
+	Status     string               `bson:"status" json:"status"`
+	SentCount  int                  `bson:"sentCount" json:"sentCount"`
+	LastSentAt time.Time            `bson:"lastSentAt,omitempty" json:"lastSentAt,omitempty"`
+	CreatedAt  time.Time            `bson:"createdAt" json:"createdAt"`
+}
+
+// next returns when the announcement is due once sentCount occurrences have
+// been sent, skipping occurrences missed while the server was down. It
+// returns false when the announcement is finished.
+func (a ScheduledAnnouncement) next(sentCount int, now time.Time) (time.Time, bool) {
+	if a.Recurrence == "" {
+		return time.Time{}, false
+	}
+	rule, err := ParseRecurrence(a.Recurrence)
+	if err != nil {
+		return time.Time{}, false
+	}
+	n := sentCount
+	at := rule.after(a.StartAt, n)
+	for !at.After(now) {
+		n++
+		at = rule.after(a.StartAt, n)
+	}
+	if rule.Count > 0 && n >= rule.Count {
+		return time.Time{}, false
+	}
+	if !rule.Until.IsZero() && at.After(rule.Until) {
+		return time.Time{}, false
+	}
+	return at, true
+}
+
+func CreateScheduledAnnouncement(announcement ScheduledAnnouncement) (*mongo.InsertOneResult, error) {
+	announcement.Message = strings.TrimSpace(announcement.Message)
+	if announcement.Message == "" || len(announcement.Message) > 2000 {
+		return nil, fmt.Errorf("invalid message")
+	}
+	if len(announcement.Channels) == 0 {
+		return nil, fmt.Errorf("choose at least one channel")
+	}
+	if announcement.Recurrence != "" {
+		if _, err := ParseRecurrence(announcement.Recurrence); err != nil {
+			return nil, err
+		}
+	}
+	if announcement.ID.IsZero() {
+		announcement.ID = primitive.NewObjectID()
+	}
+	announcement.SendAt = announcement.StartAt
+	announcement.Status = ScheduleStatus.Scheduled
+	announcement.CreatedAt = time.Now()
+
+	collection := GetCollection("scheduledannouncements")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return collection.InsertOne(ctx, announcement)
+}
+
+func GetScheduledAnnouncementByID(id primitive.ObjectID) (ScheduledAnnouncement, error) {
+	var announcement ScheduledAnnouncement
+	collection := GetCollection("scheduledannouncements")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&announcement)
+	return announcement, err
+}
+
+func GetScheduledAnnouncements(filter bson.M) ([]ScheduledAnnouncement, error) {
+	announcements := []ScheduledAnnouncement{}
+	collection := GetCollection("scheduledannouncements")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(bson.M{"sendAt": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var announcement ScheduledAnnouncement
+		if err := cursor.Decode(&announcement); err != nil {
+			continue
+		}
+		announcements = append(announcements, announcement)
+	}
+	return announcements, nil
+}
+
+// CancelScheduledAnnouncement stops an announcement that is still scheduled.
+func CancelScheduledAnnouncement(id primitive.ObjectID) error {
+	collection := GetCollection("scheduledannouncements")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": id, "status": ScheduleStatus.Scheduled}
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"status": ScheduleStatus.Cancelled}})
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return fmt.Errorf("announcement is not scheduled")
+	}
+	return nil
+}
+
+// SendDueScheduledAnnouncements sends every announcement whose time has come. Each
+// occurrence is claimed by moving SendAt forward first, so it is sent once
+// even with several instances running.
+func SendDueScheduledAnnouncements() error {
+	due, err := GetScheduledAnnouncements(bson.M{"status": ScheduleStatus.Scheduled, "sendAt": bson.M{"$lte": time.Now()}})
+	if err != nil {
+		return err
+	}
+
+	collection := GetCollection("scheduledannouncements")
+	for _, announcement := range due {
+		now := time.Now()
+		set := bson.M{"lastSentAt": now, "sentCount": announcement.SentCount + 1}
+		if next, ok := announcement.next(announcement.SentCount+1, now); ok {
+			set["sendAt"] = next
+		} else {
+			set["status"] = ScheduleStatus.Completed
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		claim := bson.M{"_id": announcement.ID, "status": ScheduleStatus.Scheduled, "sendAt": announcement.SendAt}
+		result, err := collection.UpdateOne(ctx, claim, bson.M{"$set": set})
+		cancel()
+		if err != nil {
+			log.Printf("Failed to claim announcement %s: %v", announcement.ID.Hex(), err)
+			continue
+		}
+		if result.ModifiedCount == 0 {
+			continue
+		}
+		for _, channel := range liveAnnouncementChannels(announcement.Channels) {
+			helpers.SendNotification(channel, announcement.Author, "%s", announcement.Message)
+		}
+	}
+	return nil
+}
+
+// liveAnnouncementChannels drops the channels and tribunes deleted since an
+// announcement was scheduled. Tribune notifications reach the tribune's
+// members and maintainers.
+func liveAnnouncementChannels(channels []primitive.ObjectID) []primitive.ObjectID {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	live := []primitive.ObjectID{}
+	filter := bson.M{"_id": bson.M{"$in": channels}}
+	for _, name := range []string{"notificationchannels", "tribune"} {
+		ids, err := GetCollection(name).Distinct(ctx, "_id", filter)
+		if err != nil {
+			// send to every channel rather than drop the announcement
+			log.Printf("Failed to look up announcement channels: %v", err)
+			return channels
+		}
+		for _, id := range ids {
+			if oid, ok := id.(primitive.ObjectID); ok {
+				live = append(live, oid)
+			}
+		}
+	}
+	return live
+}
+
+// StartAnnouncementScheduler sends due announcements every interval.
+func StartAnnouncementScheduler(interval time.Duration) {
+	go func() {
+		for {
+			if err := SendDueScheduledAnnouncements(); err != nil {
+				log.Printf("Failed to send announcements: %v", err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
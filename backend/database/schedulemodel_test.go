@@ -0,0 +1,86 @@
+package database
+
+import (
+	"hermes/helpers"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// useMockDatabase points the package at a mock deployment that answers
+// commands with the responses the test queues.
+func useMockDatabase(mt *mtest.T) {
+	previous := Client
+	Client = mt.Client
+	mt.Cleanup(func() { Client = previous })
+}
+
+func TestSendDueAnnouncementToTribune(t *testing.T) {
+	t.Setenv("MONGO_DATABASE", "hermes")
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("tribune", func(mt *mtest.T) {
+		useMockDatabase(mt)
+		tribuneID := primitive.NewObjectID()
+		deletedID := primitive.NewObjectID()
+		subscription := helpers.Notifications.Subscribe(tribuneID, deletedID)
+		defer subscription.Close()
+
+		announcement := ScheduledAnnouncement{
+			ID:        primitive.NewObjectID(),
+			Channels:  []primitive.ObjectID{tribuneID, deletedID},
+			Message:   "Exam moved to room 4",
+			Author:    "Teacher",
+			StartAt:   time.Now().Add(-time.Minute),
+			SendAt:    time.Now().Add(-time.Minute),
+			Status:    ScheduleStatus.Scheduled,
+			CreatedAt: time.Now().Add(-time.Hour),
+		}
+		raw, err := bson.Marshal(announcement)
+		if err != nil {
+			mt.Fatal(err)
+		}
+		var doc bson.D
+		if err := bson.Unmarshal(raw, &doc); err != nil {
+			mt.Fatal(err)
+		}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "hermes.scheduledannouncements", mtest.FirstBatch, doc),
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}},
+			bson.D{{Key: "ok", Value: 1}, {Key: "values", Value: bson.A{}}},
+			bson.D{{Key: "ok", Value: 1}, {Key: "values", Value: bson.A{tribuneID}}},
+		)
+
+		if err := SendDueScheduledAnnouncements(); err != nil {
+			mt.Fatal(err)
+		}
+
+		select {
+		case notification := <-subscription.Events():
+			if notification.ObjectID != tribuneID || notification.Message != announcement.Message {
+				mt.Fatalf("unexpected notification: %+v", notification)
+			}
+		default:
+			mt.Fatal("the announcement did not reach the tribune")
+		}
+		select {
+		case notification := <-subscription.Events():
+			mt.Fatalf("announcement sent to a deleted channel: %+v", notification)
+		default:
+		}
+
+		// the tribune lookup must run against the collection tribunes live in
+		looked := map[string]bool{}
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.CommandName == "distinct" {
+				looked[event.Command.Lookup("distinct").StringValue()] = true
+			}
+		}
+		if !looked["tribune"] || !looked["notificationchannels"] {
+			mt.Fatalf("channels were looked up in %v", looked)
+		}
+	})
+}
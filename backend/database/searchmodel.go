@@ -0,0 +1,194 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type SearchTypes struct {
+	Course  string
+	Lecture string
+	Section string
+	Message string
+}
+
+var SearchType = SearchTypes{
+	Course:  "course",
+	Lecture: "lecture",
+	Section: "section",
+	Message: "message",
+}
+
+// SearchResult is a single hit of a text search. Text is the matched field
+// the snippet is built from.
+type SearchResult struct {
+	Type    string              `json:"type"`
+	ID      primitive.ObjectID  `json:"id"`
+	Title   string              `json:"title"`
+	Text    string              `json:"-"`
+	Snippet string              `json:"snippet"`
+	Score   float64             `json:"score"`
+	Tribune *primitive.ObjectID `json:"tribune,omitempty"`
+	Kind    string              `json:"kind,omitempty"`
+}
+
+// SearchScope limits what a search may return. A nil Tribunes list means all
+// tribunes are visible, used for admins.
+type SearchScope struct {
+	Types    map[string]bool
+	Tribunes []primitive.ObjectID
+}
+
+type searchSource struct {
+	kind       string
+	collection string
+	projection bson.M
+	toResult   func(bson.M) SearchResult
+}
+
+var searchSources = []searchSource{
+	{
+		kind:       SearchType.Course,
+		collection: "courses",
+		projection: bson.M{"name": 1, "code": 1, "description": 1},
+		toResult: func(doc bson.M) SearchResult {
+			return SearchResult{
+				Title: joinNonEmpty(stringField(doc, "code"), stringField(doc, "name")),
+				Text:  stringField(doc, "description"),
+			}
+		},
+	},
+	{
+		kind:       SearchType.Lecture,
+		collection: "lecture",
+		projection: bson.M{"name": 1, "code": 1, "description": 1},
+		toResult: func(doc bson.M) SearchResult {
+			return SearchResult{
+				Title: joinNonEmpty(stringField(doc, "code"), stringField(doc, "name")),
+				Text:  stringField(doc, "description"),
+			}
+		},
+	},
+	{
+		kind:       SearchType.Section,
+		collection: "section",
+		projection: bson.M{"name": 1, "code": 1, "description": 1},
+		toResult: func(doc bson.M) SearchResult {
+			return SearchResult{
+				Title: joinNonEmpty(stringField(doc, "code"), stringField(doc, "name")),
+				Text:  stringField(doc, "description"),
+			}
+		},
+	},
+	{
+		kind:       SearchType.Message,
+		collection: "messages",
+		projection: bson.M{"content": 1, "title": 1, "tribune": 1, "kind": 1},
+		toResult: func(doc bson.M) SearchResult {
+			result := SearchResult{
+				Title: stringField(doc, "title"),
+				Text:  stringField(doc, "content"),
+				Kind:  stringField(doc, "kind"),
+			}
+			if result.Kind == "" {
+				result.Kind = MessageKind.PlainText
+			}
+			if tribune, ok := doc["tribune"].(primitive.ObjectID); ok {
+				result.Tribune = &tribune
+			}
+			return result
+		},
+	},
+}
+
+// Search runs a text search over every source in scope and merges the hits
+// by relevance.
+func Search(query string, scope SearchScope, limit int64) ([]SearchResult, error) {
+	results := []SearchResult{}
+	for _, source := range searchSources {
+		if len(scope.Types) > 0 && !scope.Types[source.kind] {
+			continue
+		}
+
+		filter := bson.M{"$text": bson.M{"$search": query}}
+		if source.kind == SearchType.Message {
+			filter["deleted"] = bson.M{"$ne": true}
+			filter["hidden"] = bson.M{"$ne": true}
+			if scope.Tribunes != nil {
+				filter["tribune"] = bson.M{"$in": scope.Tribunes}
+			}
+		}
+
+		hits, err := searchCollection(source, filter, limit)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, hits...)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if int64(len(results)) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+func searchCollection(source searchSource, filter bson.M, limit int64) ([]SearchResult, error) {
+	var results []SearchResult
+	collection := GetCollection(source.collection)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	projection := bson.M{"score": bson.M{"$meta": "textScore"}}
+	for field, value := range source.projection {
+		projection[field] = value
+	}
+	opts := options.Find().
+		SetProjection(projection).
+		SetSort(bson.M{"score": bson.M{"$meta": "textScore"}}).
+		SetLimit(limit)
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			continue
+		}
+		result := source.toResult(doc)
+		result.Type = source.kind
+		result.ID, _ = doc["_id"].(primitive.ObjectID)
+		result.Score, _ = doc["score"].(float64)
+		results = append(results, result)
+	}
+	return results, cursor.Err()
+}
+
+func stringField(doc bson.M, field string) string {
+	value, _ := doc[field].(string)
+	return value
+}
+
+func joinNonEmpty(parts ...string) string {
+	joined := ""
+	for _, part := range parts {
+		if part == "" {
+			continue
+		}
+		if joined != "" {
+			joined += " - "
+		}
+		joined += part
+	}
+	return joined
+}
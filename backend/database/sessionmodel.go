@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Session records a login. Its ID is carried in the JWT "sid" claim so the
+// token stops working once the session is revoked. Impersonation sessions
+// belong to the impersonated user and name the admin in Impersonator.
+type Session struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	User       primitive.ObjectID `bson:"user" json:"user"`
+	UserAgent  string             `bson:"userAgent" json:"userAgent"`
+	IP         string             `bson:"ip" json:"ip"`
+	CreatedAt  time.Time          `bson:"createdAt" json:"createdAt"`
+	LastSeenAt time.Time          `bson:"lastSeenAt" json:"lastSeenAt"`
+	ExpiresAt  time.Time          `bson:"expiresAt" json:"expiresAt"`
+	RevokedAt  time.Time          `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+
+	Impersonator primitive.ObjectID `bson:"impersonator,omitempty" json:"impersonator,omitempty"`
+}
+
+func (s Session) IsActive() bool {
+	return s.RevokedAt.IsZero() && time.Now().Before(s.ExpiresAt)
+}
+
+func CreateSession(session Session) (*mongo.InsertOneResult, error) {
+	collection := GetCollection("sessions")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return collection.InsertOne(ctx, session)
+}
+
+func GetSessionByID(id primitive.ObjectID) (Session, error) {
+	var session Session
+	collection := GetCollection("sessions")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&session)
+	return session, err
+}
+
+// GetActiveSessionsForUser returns the sessions that have not been revoked
+// or expired, most recently used first.
+func GetActiveSessionsForUser(userID primitive.ObjectID) ([]Session, error) {
+	var sessions []Session
+	collection := GetCollection("sessions")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"user":      userID,
+		"revokedAt": bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}
+	opts := options.Find().SetSort(bson.M{"lastSeenAt": -1})
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var session Session
+		if err := cursor.Decode(&session); err != nil {
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+func TouchSession(id primitive.ObjectID, ip string) (*mongo.UpdateResult, error) {
+	collection := GetCollection("sessions")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return collection.UpdateByID(ctx, id, bson.M{"$set": bson.M{"lastSeenAt": time.Now(), "ip": ip}})
+}
+
+func RevokeSession(id primitive.ObjectID, userID primitive.ObjectID) (*mongo.UpdateResult, error) {
+	collection := GetCollection("sessions")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": id, "user": userID, "revokedAt": bson.M{"$exists": false}}
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"revokedAt": time.Now()}})
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, fmt.Errorf("session not found")
+	}
+	return result, nil
+}
+
+// RevokeOtherSessions signs the user out everywhere except the session
+// identified by keep.
+func RevokeOtherSessions(userID primitive.ObjectID, keep primitive.ObjectID) (*mongo.UpdateResult, error) {
+	collection := GetCollection("sessions")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"user": userID, "_id": bson.M{"$ne": keep}, "revokedAt": bson.M{"$exists": false}}
+	return collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revokedAt": time.Now()}})
+}
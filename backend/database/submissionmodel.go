@@ -0,0 +1,184 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const SubmissionBucket = "submissions"
+
+// Submission is a student's answer to an assignment message. A student has
+// at most one submission per assignment, resubmitting replaces it until it
+// is graded.
+type Submission struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	Assignment  primitive.ObjectID `bson:"assignment"`
+	Tribune     primitive.ObjectID `bson:"tribune"`
+	User        primitive.ObjectID `bson:"user"`
+	Text        string             `bson:"text"`
+	Files       []StoredFile       `bson:"files"`
+	SubmittedAt time.Time          `bson:"submittedAt"`
+	Late        bool               `bson:"late"`
+	Attempts    int                `bson:"attempts"`
+
+	Graded   bool               `bson:"graded"`
+	RawGrade float64            `bson:"rawGrade"`
+	Grade    float64            `bson:"grade"`
+	Feedback string             `bson:"feedback"`
+	GradedBy primitive.ObjectID `bson:"gradedBy,omitempty"`
+	GradedAt time.Time          `bson:"gradedAt,omitempty"`
+}
+
+// ErrSubmissionGraded is returned when a student resubmits after their
+// submission was graded.
+var ErrSubmissionGraded = errors.New("submission has already been graded")
+
+// SubmitAssignment stores the user's submission, replacing an earlier one
+// that has not been graded yet. Files replaced by the new submission are
+// returned so they can be removed.
+func SubmitAssignment(submission Submission) (Submission, []StoredFile, error) {
+	collection := GetCollection("submissions")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// a graded submission does not match, so the upsert runs into the unique
+	// assignment and user index instead of replacing it
+	filter := bson.M{"assignment": submission.Assignment, "user": submission.User, "graded": bson.M{"$ne": true}}
+	update := bson.M{
+		"$set": bson.M{
+			"tribune":     submission.Tribune,
+			"text":        submission.Text,
+			"files":       submission.Files,
+			"submittedAt": submission.SubmittedAt,
+			"late":        submission.Late,
+		},
+		"$setOnInsert": bson.M{
+			"graded":   false,
+			"rawGrade": 0,
+			"grade":    0,
+			"feedback": "",
+		},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before)
+
+	var previous Submission
+	err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&previous)
+	if mongo.IsDuplicateKeyError(err) {
+		return submission, nil, ErrSubmissionGraded
+	}
+	if err != nil && err != mongo.ErrNoDocuments {
+		return submission, nil, err
+	}
+
+	saved, err := GetSubmissionForUser(submission.Assignment, submission.User)
+	return saved, previous.Files, err
+}
+
+func GetSubmissionByID(id primitive.ObjectID) (Submission, error) {
+	var submission Submission
+	collection := GetCollection("submissions")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&submission)
+	return submission, err
+}
+
+func GetSubmissionForUser(assignmentID primitive.ObjectID, userID primitive.ObjectID) (Submission, error) {
+	var submission Submission
+	collection := GetCollection("submissions")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := collection.FindOne(ctx, bson.M{"assignment": assignmentID, "user": userID}).Decode(&submission)
+	return submission, err
+}
+
+func GetSubmissionsForAssignment(assignmentID primitive.ObjectID) ([]Submission, error) {
+	var submissions []Submission
+	collection := GetCollection("submissions")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"submittedAt": 1})
+	cursor, err := collection.Find(ctx, bson.M{"assignment": assignmentID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var submission Submission
+		if err := cursor.Decode(&submission); err != nil {
+			continue
+		}
+		submissions = append(submissions, submission)
+	}
+	return submissions, nil
+}
+
+// GradeSubmission records a grade and feedback. The late penalty of the
+// assignment is applied to the raw grade.
+func GradeSubmission(id primitive.ObjectID, assignment *Assignment, rawGrade float64, feedback string, gradedBy primitive.ObjectID) (Submission, error) {
+	submission, err := GetSubmissionByID(id)
+	if err != nil {
+		return submission, fmt.Errorf("submission not found")
+	}
+	if rawGrade < 0 || (assignment.MaxGrade > 0 && rawGrade > assignment.MaxGrade) {
+		return submission, fmt.Errorf("grade must be between 0 and %v", assignment.MaxGrade)
+	}
+
+	grade := rawGrade
+	if submission.Late && assignment.LatePolicy == LatePolicy.Penalty {
+		grade = rawGrade * (1 - assignment.LatePenalty/100)
+	}
+
+	collection := GetCollection("submissions")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$set": bson.M{
+			"graded":   true,
+			"rawGrade": rawGrade,
+			"grade":    grade,
+			"feedback": feedback,
+			"gradedBy": gradedBy,
+			"gradedAt": time.Now(),
+		},
+	}
+	if _, err := collection.UpdateByID(ctx, id, update); err != nil {
+		return submission, err
+	}
+	return GetSubmissionByID(id)
+}
+
+// GetGradedSubmissionsForTribune returns the graded submissions to every
+// assignment of a tribune.
+func GetGradedSubmissionsForTribune(tribuneID primitive.ObjectID) ([]Submission, error) {
+	var submissions []Submission
+	collection := GetCollection("submissions")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := collection.Find(ctx, bson.M{"tribune": tribuneID, "graded": true})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var submission Submission
+		if err := cursor.Decode(&submission); err != nil {
+			continue
+		}
+		submissions = append(submissions, submission)
+	}
+	return submissions, nil
+}
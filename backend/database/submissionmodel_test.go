@@ -0,0 +1,72 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestResubmissionKeepsGrade(t *testing.T) {
+	t.Setenv("MONGO_DATABASE", "hermes")
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	submission := Submission{
+		Assignment:  primitive.NewObjectID(),
+		Tribune:     primitive.NewObjectID(),
+		User:        primitive.NewObjectID(),
+		Text:        "second try",
+		SubmittedAt: time.Now(),
+	}
+
+	mt.Run("graded", func(mt *mtest.T) {
+		useMockDatabase(mt)
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code:    11000,
+			Name:    "DuplicateKey",
+			Message: "E11000 duplicate key error collection: hermes.submissions",
+		}))
+
+		if _, _, err := SubmitAssignment(submission); err != ErrSubmissionGraded {
+			mt.Fatalf("resubmitting a graded submission returned %v", err)
+		}
+	})
+
+	mt.Run("ungraded", func(mt *mtest.T) {
+		useMockDatabase(mt)
+		saved := bson.D{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "assignment", Value: submission.Assignment},
+			{Key: "user", Value: submission.User},
+			{Key: "text", Value: submission.Text},
+			{Key: "attempts", Value: 2},
+		}
+		mt.AddMockResponses(
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: bson.D{{Key: "text", Value: "first try"}}}},
+			mtest.CreateCursorResponse(0, "hermes.submissions", mtest.FirstBatch, saved),
+		)
+
+		result, _, err := SubmitAssignment(submission)
+		if err != nil {
+			mt.Fatal(err)
+		}
+		if result.Text != submission.Text || result.Attempts != 2 {
+			mt.Fatalf("unexpected submission: %+v", result)
+		}
+
+		command := mt.GetStartedEvent().Command
+		graded := command.Lookup("query", "graded", "$ne")
+		if ok, _ := graded.BooleanOK(); !ok {
+			mt.Fatalf("resubmission does not skip graded submissions: %s", command.Lookup("query"))
+		}
+		for _, field := range []string{"graded", "grade", "rawGrade", "feedback"} {
+			if _, err := command.LookupErr("update", "$set", field); err == nil {
+				mt.Fatalf("resubmission overwrites %s: %s", field, command.Lookup("update"))
+			}
+		}
+		if _, err := command.LookupErr("update", "$unset"); err == nil {
+			mt.Fatalf("resubmission unsets grading fields: %s", command.Lookup("update"))
+		}
+	})
+}
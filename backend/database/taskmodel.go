@@ -14,6 +14,9 @@ type Task struct {
 	Title  string             `bson:"title"`
 	IsDone bool               `bson:"is_done"`
 	User   primitive.ObjectID `bson:"userid"`
+	// DueDate is optional, tasks with one get deadline reminders. It is sent
+	// as due_date, the same key updates use.
+	DueDate primitive.DateTime `bson:"due_date,omitempty" json:"due_date,omitempty"`
 }
 
 func CreateTask(task Task) (*mongo.InsertOneResult, error) {
@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"hermes/helpers"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -15,58 +16,70 @@ type Tribune struct {
 	Description string               `bson:"description"`
 	Maintainers []primitive.ObjectID `bson:"maintainers"`
 	CourseID    primitive.ObjectID   `bson:"courseID"`
-	Messages    []Message            `bson:"messages"`
-}
-type Message interface {
-	GetID() primitive.ObjectID
-	GetContent() string
-	GetUser() primitive.ObjectID
-	GetDate() primitive.DateTime
+	// LectureID narrows a course tribune down to a single lecture.
+	LectureID primitive.ObjectID `bson:"lectureID,omitempty"`
+	// Members are the students enrolled in the linked course or lecture. The
+	// list is kept in sync on enrollment and never set by clients.
+	Members []primitive.ObjectID `bson:"members"`
+	// AllowStudentPosts lets enrolled students post to the discussion, not
+	// only the maintainers.
+	AllowStudentPosts bool `bson:"allowStudentPosts"`
 }
 
-type PlainText struct {
-	ID      primitive.ObjectID `bson:"_id,omitempty"`
-	Content string             `bson:"content"`
-	User    primitive.ObjectID `bson:"user"`
-	Date    primitive.DateTime `bson:"date"`
+func (t Tribune) IsMaintainer(userID primitive.ObjectID) bool {
+	for _, maintainer := range t.Maintainers {
+		if maintainer == userID {
+			return true
+		}
+	}
+	return false
 }
 
-func (pt *PlainText) GetID() primitive.ObjectID   { return pt.ID }
-func (pt *PlainText) GetContent() string          { return pt.Content }
-func (pt *PlainText) GetUser() primitive.ObjectID { return pt.User }
-func (pt *PlainText) GetDate() primitive.DateTime { return pt.Date }
-
-type Assignment struct {
-	ID       primitive.ObjectID `bson:"_id,omitempty"`
-	Content  string             `bson:"content"`
-	User     primitive.ObjectID `bson:"user"`
-	Date     primitive.DateTime `bson:"date"`
-	DeadLine primitive.DateTime `bson:"deadline"`
+// IsMember reports whether the user maintains the tribune or is a member
+// through enrollment.
+func (t Tribune) IsMember(userID primitive.ObjectID) bool {
+	if t.IsMaintainer(userID) {
+		return true
+	}
+	for _, member := range t.Members {
+		if member == userID {
+			return true
+		}
+	}
+	return false
 }
 
-func PostMessage(message Message, id primitive.ObjectID) (*mongo.UpdateResult, error) {
-	collection := GetCollection("tribune")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	update := bson.M{
-		"$addToSet": bson.M{"messages": message},
-	}
-	return collection.UpdateByID(ctx, id, update)
+// IsLinked reports whether membership is derived from a course or lecture.
+func (t Tribune) IsLinked() bool {
+	return !t.CourseID.IsZero() || !t.LectureID.IsZero()
 }
 
 func CreateTribune(tribune Tribune) (*mongo.InsertOneResult, error) {
 	collection := GetCollection("tribune")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
+	if tribune.ID.IsZero() {
+		tribune.ID = primitive.NewObjectID()
+	}
+	members, err := linkedMembers(tribune)
+	if err != nil {
+		return nil, err
+	}
+	tribune.Members = members
+	result, err := collection.InsertOne(ctx, tribune)
+	if err != nil {
+		return nil, err
+	}
+	notifySubscriptionsChanged(append(tribune.Maintainers, tribune.Members...))
+
 	creator, _ := GetUserByID(tribune.Maintainers[0])
-	var createdmessage PlainText = PlainText{
+	var createdmessage PlainText = PlainText{MessageBase{
 		ID:      primitive.NewObjectID(),
 		Content: "This Tribune Was Created by " + creator.Name,
 		User:    creator.ID,
 		Date:    primitive.NewDateTimeFromTime(time.Now()),
-	}
-	tribune.Messages = append(tribune.Messages, &createdmessage)
-	result, err := collection.InsertOne(ctx, tribune)
+	}}
+	_, err = PostMessage(&createdmessage, tribune.ID)
 	return result, err
 }
 
@@ -95,9 +108,41 @@ func UpdateTribune(id primitive.ObjectID, updatedData Tribune) (*mongo.UpdateRes
 	update := bson.M{
 		"$set": updatedData,
 	}
+	// lectureID is omitted when empty, so a tribune moved to a whole course or
+	// unlinked has to drop it explicitly
+	if updatedData.LectureID.IsZero() {
+		update["$unset"] = bson.M{"lectureID": ""}
+	}
 
+	var old Tribune
+	if err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&old); err != nil {
+		return nil, err
+	}
 	result, err := collection.UpdateOne(ctx, bson.M{"_id": id}, update)
-	return result, err
+	if err != nil {
+		return nil, err
+	}
+	notifySubscriptionsChanged(changedMembers(old.Maintainers, updatedData.Maintainers))
+	return result, nil
+}
+
+// changedMembers returns the users in only one of the two lists, whose
+// tribune notifications start or stop.
+func changedMembers(before, after []primitive.ObjectID) []primitive.ObjectID {
+	count := map[primitive.ObjectID]int{}
+	for _, id := range before {
+		count[id] |= 1
+	}
+	for _, id := range after {
+		count[id] |= 2
+	}
+	changed := []primitive.ObjectID{}
+	for id, in := range count {
+		if in != 3 {
+			changed = append(changed, id)
+		}
+	}
+	return changed
 }
 
 func DeleteTribune(id primitive.ObjectID) (*mongo.DeleteResult, error) {
@@ -105,17 +150,36 @@ func DeleteTribune(id primitive.ObjectID) (*mongo.DeleteResult, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	tribune, _ := GetTribuneByID(id)
 	result, err := collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return nil, err
+	}
+	notifySubscriptionsChanged(append(tribune.Maintainers, tribune.Members...))
+	_, err = GetCollection("messages").DeleteMany(ctx, bson.M{"tribune": id})
 	return result, err
 }
 
 func GetAllTribunes() ([]Tribune, error) {
+	return findTribunes(bson.M{})
+}
+
+// GetTribunesForUser returns the tribunes the user maintains or is a member
+// of.
+func GetTribunesForUser(userID primitive.ObjectID) ([]Tribune, error) {
+	return findTribunes(bson.M{"$or": []bson.M{
+		{"maintainers": userID},
+		{"members": userID},
+	}})
+}
+
+func findTribunes(filter bson.M) ([]Tribune, error) {
 	var tribunes []Tribune
 	collection := GetCollection("tribune")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	cursor, err := collection.Find(ctx, bson.M{})
+	cursor, err := collection.Find(ctx, filter)
 	if err != nil {
 		return nil, err
 	}
@@ -132,3 +196,125 @@ func GetAllTribunes() ([]Tribune, error) {
 
 	return tribunes, nil
 }
+
+// linkedMembers lists the students enrolled in the lecture, or in any lecture
+// of the course, the tribune is linked to.
+func linkedMembers(tribune Tribune) ([]primitive.ObjectID, error) {
+	members := []primitive.ObjectID{}
+	var lectures []Lecture
+	var err error
+	if !tribune.LectureID.IsZero() {
+		var lecture Lecture
+		lecture, err = GetLectureByID(tribune.LectureID)
+		lectures = []Lecture{lecture}
+	} else if !tribune.CourseID.IsZero() {
+		lectures, err = GetLecturesForCourse(tribune.CourseID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[primitive.ObjectID]bool{}
+	for _, lecture := range lectures {
+		for _, user := range lecture.Users {
+			if !seen[user] {
+				seen[user] = true
+				members = append(members, user)
+			}
+		}
+	}
+	return members, nil
+}
+
+// SyncTribuneMembers recomputes the members of a linked tribune from the
+// current enrollments.
+func SyncTribuneMembers(id primitive.ObjectID) error {
+	tribune, err := GetTribuneByID(id)
+	if err != nil {
+		return err
+	}
+	members, err := linkedMembers(tribune)
+	if err != nil {
+		return err
+	}
+
+	collection := GetCollection("tribune")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = collection.UpdateByID(ctx, id, bson.M{"$set": bson.M{"members": members}})
+	if err != nil {
+		return err
+	}
+	notifySubscriptionsChanged(changedMembers(tribune.Members, members))
+	return nil
+}
+
+// AddUserToLinkedTribunes gives a newly enrolled student access to the
+// tribunes of the lecture and of its course.
+func AddUserToLinkedTribunes(userID primitive.ObjectID, lecture Lecture) error {
+	collection := GetCollection("tribune")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := collection.UpdateMany(ctx, linkedTribunesFilter(lecture, true), bson.M{"$addToSet": bson.M{"members": userID}})
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount > 0 {
+		helpers.SendEvent(userID, helpers.SubscriptionsChangedEvent, nil)
+	}
+	return nil
+}
+
+// RemoveUserFromLinkedTribunes revokes access after a student leaves a
+// lecture. Course tribunes are kept while the student is still enrolled in
+// another lecture of the course.
+func RemoveUserFromLinkedTribunes(userID primitive.ObjectID, lecture Lecture) error {
+	collection := GetCollection("tribune")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	enrolled, err := IsUserEnrolledInCourse(userID, lecture.Course)
+	if err != nil {
+		return err
+	}
+	result, err := collection.UpdateMany(ctx, linkedTribunesFilter(lecture, !enrolled), bson.M{"$pull": bson.M{"members": userID}})
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount > 0 {
+		helpers.SendEvent(userID, helpers.SubscriptionsChangedEvent, nil)
+	}
+	return nil
+}
+
+// linkedTribunesFilter matches the tribunes of a lecture and, with course
+// set, the tribunes linked to its whole course.
+func linkedTribunesFilter(lecture Lecture, course bool) bson.M {
+	if !course || lecture.Course.IsZero() {
+		return bson.M{"lectureID": lecture.ID}
+	}
+	return bson.M{"$or": []bson.M{
+		{"lectureID": lecture.ID},
+		{"courseID": lecture.Course, "lectureID": bson.M{"$exists": false}},
+	}}
+}
+
+// SyncLinkedTribuneMembers backfills the members of every linked tribune.
+func SyncLinkedTribuneMembers() (int, error) {
+	tribunes, err := findTribunes(bson.M{"$or": []bson.M{
+		{"courseID": bson.M{"$nin": []interface{}{nil, primitive.NilObjectID}}},
+		{"lectureID": bson.M{"$exists": true}},
+	}})
+	if err != nil {
+		return 0, err
+	}
+	synced := 0
+	for _, tribune := range tribunes {
+		if err := SyncTribuneMembers(tribune.ID); err != nil {
+			return synced, err
+		}
+		synced++
+	}
+	return synced, nil
+}
@@ -9,6 +9,7 @@ import (
 	"image"
 	"image/jpeg"
 	"mime/multipart"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -45,6 +46,8 @@ type User struct {
 	GradedCourses        []GradedCourse       `bson:"gradedCourses"`
 	Role                 string               `bson:"role" default:"student"`
 	NotificationSubs     []primitive.ObjectID `bson:"notificationsubs"`
+	OIDCSubject          string               `bson:"oidcSubject,omitempty"`
+	PasswordHistory      []string             `bson:"passwordHistory" json:"-"`
 }
 
 type Roles struct {
@@ -66,8 +69,8 @@ func CreateUser(user User) (*mongo.InsertOneResult, error) {
 	if !validators.IsValidEmail(user.Email) {
 		return nil, fmt.Errorf("invalid Email")
 	}
-	if !validators.IsValidPassword(user.Password) {
-		return nil, fmt.Errorf("invalid Password")
+	if err := validators.LoadPasswordPolicy().Validate(user.Password, user.Username, user.Email); err != nil {
+		return nil, err
 	}
 
 	hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), 10)
@@ -75,7 +78,7 @@ func CreateUser(user User) (*mongo.InsertOneResult, error) {
 		return nil, fmt.Errorf("failed to hash password")
 	}
 	user.Password = string(hash)
-	user.NotificationSubs = append(user.NotificationSubs, helpers.AnnouncementsChannelID, helpers.SystemAlertsChannelID)
+	user.NotificationSubs = append(user.NotificationSubs, newUserNotificationChannels(user.Role)...)
 
 	collection := GetCollection("users")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -87,6 +90,47 @@ func CreateUser(user User) (*mongo.InsertOneResult, error) {
 	return result, err
 }
 
+// CreateSSOUser provisions an account for a user signing in through the
+// identity provider. The account gets a random password so it can only be
+// used through single sign-on until the user resets it.
+func CreateSSOUser(user User) (*mongo.InsertOneResult, error) {
+	if !validators.IsValidEmail(user.Email) {
+		return nil, fmt.Errorf("invalid Email")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(helpers.GenerateRandomToken(32)), 10)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password")
+	}
+	user.Password = string(hash)
+	if user.Role == "" {
+		user.Role = UserRole.Student
+	}
+	user.NotificationSubs = append(user.NotificationSubs, newUserNotificationChannels(user.Role)...)
+
+	collection := GetCollection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// usernames are unique, so fall back to a numbered variant on collision
+	base := user.Username
+	for attempt := 1; attempt <= 20; attempt++ {
+		result, err := collection.InsertOne(ctx, user)
+		if err == nil {
+			return result, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+		var existing User
+		if collection.FindOne(ctx, bson.M{"email": user.Email}).Decode(&existing) == nil {
+			return nil, fmt.Errorf("username/email already exists")
+		}
+		user.Username = fmt.Sprintf("%s%d", base, attempt)
+	}
+	return nil, fmt.Errorf("username/email already exists")
+}
+
 func UpdateUser(id primitive.ObjectID, updatedData bson.M) (*mongo.UpdateResult, error) {
 	collection := GetCollection("users")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -129,6 +173,61 @@ func GetUserByUsername(username string) (User, error) {
 	return user, err
 }
 
+// GetUsersByUsernames looks up several users at once, skipping unknown
+// usernames.
+func GetUsersByUsernames(usernames []string) ([]User, error) {
+	var users []User
+	collection := GetCollection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	projection := bson.M{"profilepic": 0}
+	cursor, err := collection.Find(ctx, bson.M{"username": bson.M{"$in": usernames}}, options.Find().SetProjection(projection))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var user User
+		if err := cursor.Decode(&user); err != nil {
+			continue
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func GetUserByEmail(email string) (User, error) {
+	var user User
+	collection := GetCollection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := collection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	return user, err
+}
+
+// FindUserByEmail looks an email up ignoring case, addresses registered
+// before single sign-on are stored as they were typed.
+func FindUserByEmail(email string) (User, error) {
+	var user User
+	collection := GetCollection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	opts := options.FindOne().SetCollation(&options.Collation{Locale: "en", Strength: 2})
+	err := collection.FindOne(ctx, bson.M{"email": strings.TrimSpace(email)}, opts).Decode(&user)
+	return user, err
+}
+
+func GetUserByOIDCSubject(subject string) (User, error) {
+	var user User
+	collection := GetCollection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := collection.FindOne(ctx, bson.M{"oidcSubject": subject}).Decode(&user)
+	return user, err
+}
+
 func DeleteUserByID(id primitive.ObjectID) (*mongo.DeleteResult, error) {
 	collection := GetCollection("users")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -268,23 +367,63 @@ func GetUserByPasswordResetToken(token string) (User, error) {
 }
 
 func ChangePassword(id primitive.ObjectID, newPassword string) (*mongo.UpdateResult, error) {
-	if !validators.IsValidPassword(newPassword) {
-		return nil, fmt.Errorf("invalid Password")
+	return SetPassword(id, newPassword, bson.M{})
+}
+
+// ResetPassword sets a new password through the reset flow and invalidates
+// the reset token.
+func ResetPassword(id primitive.ObjectID, newPassword string) (*mongo.UpdateResult, error) {
+	return SetPassword(id, newPassword, bson.M{
+		"passwordResetToken":   "",
+		"passwordResetExpires": time.Time{},
+	})
+}
+
+// SetPassword applies the password policy, rejects reuse of the current or
+// recent passwords and stores the new hash along with extra fields.
+func SetPassword(id primitive.ObjectID, newPassword string, extra bson.M) (*mongo.UpdateResult, error) {
+	user, err := GetUserByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("user not found")
 	}
 
-	collection := GetCollection("users")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	policy := validators.LoadPasswordPolicy()
+	if err := policy.Validate(newPassword, user.Username, user.Email); err != nil {
+		return nil, err
+	}
+
+	previous := append([]string{user.Password}, user.PasswordHistory...)
+	if len(previous) > policy.HistorySize+1 {
+		previous = previous[:policy.HistorySize+1]
+	}
+	for _, hash := range previous {
+		if hash != "" && bcrypt.CompareHashAndPassword([]byte(hash), []byte(newPassword)) == nil {
+			return nil, fmt.Errorf("password was used recently, choose another one")
+		}
+	}
 
 	hashPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), 10)
 	if err != nil {
 		return nil, fmt.Errorf("invalid Password Hash")
 	}
 
+	history := []string{}
+	if policy.HistorySize > 0 && user.Password != "" {
+		history = previous[:min(len(previous), policy.HistorySize)]
+	}
+
 	updatedData := bson.M{
-		"password": string(hashPassword),
+		"password":        string(hashPassword),
+		"passwordHistory": history,
+	}
+	for key, value := range extra {
+		updatedData[key] = value
 	}
 
+	collection := GetCollection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
 	updated := bson.M{
 		"$set": updatedData,
 	}
@@ -485,13 +624,21 @@ func contains(slice []primitive.ObjectID, item primitive.ObjectID) bool {
 	return false
 }
 
+// newUserNotificationChannels returns the channels a new account starts
+// subscribed to. Accounts without a role are students.
+func newUserNotificationChannels(role string) []primitive.ObjectID {
+	if role == "" {
+		role = UserRole.Student
+	}
+	return RoleNotificationChannels(role)
+}
+
 func SubscribeToNotification(userID, channelID primitive.ObjectID) (*mongo.UpdateResult, error) {
 	collection := GetCollection("users")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	update := bson.M{
-		"$set":      bson.M{"notificationsubs": bson.M{"$ifNull": bson.A{"$notificationsubs", bson.A{}}}},
 		"$addToSet": bson.M{"notificationsubs": channelID},
 	}
 
@@ -499,6 +646,7 @@ func SubscribeToNotification(userID, channelID primitive.ObjectID) (*mongo.Updat
 	if err != nil {
 		return nil, fmt.Errorf("error subscribing user to notification: %v", err)
 	}
+	helpers.SendEvent(userID, helpers.SubscriptionsChangedEvent, nil)
 	return result, nil
 }
 
@@ -515,6 +663,7 @@ func UnsubscribeFromNotification(userID, channelID primitive.ObjectID) (*mongo.U
 	if err != nil {
 		return nil, fmt.Errorf("error unsubscribing user from notification: %v", err)
 	}
+	helpers.SendEvent(userID, helpers.SubscriptionsChangedEvent, nil)
 	return result, nil
 }
 
@@ -0,0 +1,432 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hermes/helpers"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type WebhookEvents struct {
+	EnrollmentCreated string
+	EnrollmentRemoved string
+	GradePosted       string
+	MessagePosted     string
+	Ping              string
+}
+
+var WebhookEvent = WebhookEvents{
+	EnrollmentCreated: "enrollment.created",
+	EnrollmentRemoved: "enrollment.removed",
+	GradePosted:       "grade.posted",
+	MessagePosted:     "tribune.message",
+	Ping:              "ping",
+}
+
+func IsValidWebhookEvent(event string) bool {
+	switch event {
+	case WebhookEvent.EnrollmentCreated, WebhookEvent.EnrollmentRemoved, WebhookEvent.GradePosted, WebhookEvent.MessagePosted:
+		return true
+	}
+	return false
+}
+
+const (
+	maxWebhookAttempts = 8
+	webhookRetryBase   = 30 * time.Second
+	webhookTimeout     = 10 * time.Second
+)
+
+// Webhook is an endpoint of an external system that receives events. A
+// webhook without events receives every event.
+type Webhook struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name      string             `bson:"name" json:"name"`
+	URL       string             `bson:"url" json:"url"`
+	Secret    string             `bson:"secret" json:"-"`
+	Events    []string           `bson:"events" json:"events"`
+	Active    bool               `bson:"active" json:"active"`
+	CreatedBy primitive.ObjectID `bson:"createdBy" json:"createdBy"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// WebhookDelivery is one attempt to hand an event to a webhook, kept as the
+// delivery log.
+type WebhookDelivery struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Webhook        primitive.ObjectID `bson:"webhook" json:"webhook"`
+	Event          string             `bson:"event" json:"event"`
+	Payload        string             `bson:"payload" json:"payload"`
+	Status         string             `bson:"status" json:"status"`
+	Attempts       int                `bson:"attempts" json:"attempts"`
+	NextAttempt    time.Time          `bson:"nextAttempt" json:"nextAttempt"`
+	ResponseStatus int                `bson:"responseStatus,omitempty" json:"responseStatus,omitempty"`
+	Error          string             `bson:"error,omitempty" json:"error,omitempty"`
+	ReplayOf       primitive.ObjectID `bson:"replayOf,omitempty" json:"replayOf,omitempty"`
+	CreatedAt      time.Time          `bson:"createdAt" json:"createdAt"`
+	DeliveredAt    time.Time          `bson:"deliveredAt,omitempty" json:"deliveredAt,omitempty"`
+}
+
+func validateWebhook(hook *Webhook) error {
+	hook.Name = strings.TrimSpace(hook.Name)
+	if hook.Name == "" || len(hook.Name) > 100 {
+		return fmt.Errorf("invalid webhook name")
+	}
+	target, err := url.Parse(hook.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("invalid webhook URL")
+	}
+	for _, event := range hook.Events {
+		if !IsValidWebhookEvent(event) {
+			return fmt.Errorf("unknown event %q", event)
+		}
+	}
+	if hook.Events == nil {
+		hook.Events = []string{}
+	}
+	return nil
+}
+
+// CreateWebhook registers a webhook with a new signing secret, which is
+// returned so it can be shown once.
+func CreateWebhook(hook Webhook) (Webhook, error) {
+	if err := validateWebhook(&hook); err != nil {
+		return hook, err
+	}
+	if hook.ID.IsZero() {
+		hook.ID = primitive.NewObjectID()
+	}
+	hook.Secret = helpers.GenerateRandomToken(32)
+	hook.CreatedAt = time.Now()
+
+	collection := GetCollection("webhooks")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := collection.InsertOne(ctx, hook)
+	return hook, err
+}
+
+func GetWebhookByID(id primitive.ObjectID) (Webhook, error) {
+	var hook Webhook
+	collection := GetCollection("webhooks")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&hook)
+	return hook, err
+}
+
+func GetWebhooks(filter bson.M) ([]Webhook, error) {
+	hooks := []Webhook{}
+	collection := GetCollection("webhooks")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var hook Webhook
+		if err := cursor.Decode(&hook); err != nil {
+			continue
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, nil
+}
+
+// UpdateWebhook changes the name, URL, events and state of a webhook. The
+// secret is kept.
+func UpdateWebhook(id primitive.ObjectID, hook Webhook) (*mongo.UpdateResult, error) {
+	if err := validateWebhook(&hook); err != nil {
+		return nil, err
+	}
+	collection := GetCollection("webhooks")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	update := bson.M{"$set": bson.M{
+		"name":   hook.Name,
+		"url":    hook.URL,
+		"events": hook.Events,
+		"active": hook.Active,
+	}}
+	return collection.UpdateByID(ctx, id, update)
+}
+
+// DeleteWebhook removes a webhook and its pending deliveries. Finished
+// deliveries stay in the log.
+func DeleteWebhook(id primitive.ObjectID) (*mongo.DeleteResult, error) {
+	collection := GetCollection("webhooks")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, err := collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return nil, err
+	}
+	_, err = GetCollection("webhookdeliveries").DeleteMany(ctx, bson.M{"webhook": id, "status": DeliveryStatus.Pending})
+	return result, err
+}
+
+// webhookWake starts a delivery round early when an event is emitted.
+var webhookWake = make(chan struct{}, 1)
+
+func wakeWebhookDelivery() {
+	select {
+	case webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// EmitWebhookEvent queues an event for every active webhook subscribed to
+// it. Failures are logged, emitting never fails the request that caused the
+// event.
+func EmitWebhookEvent(event string, data interface{}) {
+	hooks, err := GetWebhooks(bson.M{
+		"active": true,
+		"$or":    []bson.M{{"events": event}, {"events": bson.M{"$size": 0}}},
+	})
+	if err != nil {
+		log.Printf("Failed to find webhooks for %s: %v", event, err)
+		return
+	}
+	queued := false
+	for _, hook := range hooks {
+		if _, err := queueWebhookDelivery(hook.ID, event, data); err != nil {
+			log.Printf("Failed to queue %s for webhook %s: %v", event, hook.ID.Hex(), err)
+			continue
+		}
+		queued = true
+	}
+	if queued {
+		wakeWebhookDelivery()
+	}
+}
+
+// QueueWebhookPing queues a ping event to a webhook, whether or not it is
+// active, so an integration can check its receiver.
+func QueueWebhookPing(hook Webhook) (WebhookDelivery, error) {
+	data := map[string]interface{}{"webhook": hook.ID, "name": hook.Name}
+	delivery, err := queueWebhookDelivery(hook.ID, WebhookEvent.Ping, data)
+	if err == nil {
+		wakeWebhookDelivery()
+	}
+	return delivery, err
+}
+
+func queueWebhookDelivery(hookID primitive.ObjectID, event string, data interface{}) (WebhookDelivery, error) {
+	delivery := WebhookDelivery{
+		ID:          primitive.NewObjectID(),
+		Webhook:     hookID,
+		Event:       event,
+		Status:      DeliveryStatus.Pending,
+		NextAttempt: time.Now(),
+		CreatedAt:   time.Now(),
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"id":        delivery.ID,
+		"event":     event,
+		"createdAt": delivery.CreatedAt,
+		"data":      data,
+	})
+	if err != nil {
+		return delivery, err
+	}
+	delivery.Payload = string(payload)
+
+	collection := GetCollection("webhookdeliveries")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = collection.InsertOne(ctx, delivery)
+	return delivery, err
+}
+
+func GetWebhookDeliveryByID(id primitive.ObjectID) (WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	collection := GetCollection("webhookdeliveries")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&delivery)
+	return delivery, err
+}
+
+// GetWebhookDeliveries returns the latest deliveries of a webhook.
+func GetWebhookDeliveries(hookID primitive.ObjectID, limit int64) ([]WebhookDelivery, error) {
+	deliveries := []WebhookDelivery{}
+	collection := GetCollection("webhookdeliveries")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"_id": -1}).SetLimit(limit)
+	cursor, err := collection.Find(ctx, bson.M{"webhook": hookID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var delivery WebhookDelivery
+		if err := cursor.Decode(&delivery); err != nil {
+			continue
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+// ReplayWebhookDelivery queues the payload of an earlier delivery again as a
+// new delivery. The payload keeps its event id so receivers can deduplicate.
+func ReplayWebhookDelivery(original WebhookDelivery) (WebhookDelivery, error) {
+	delivery := replayDelivery(original, time.Now())
+	collection := GetCollection("webhookdeliveries")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := collection.InsertOne(ctx, delivery); err != nil {
+		return delivery, err
+	}
+	wakeWebhookDelivery()
+	return delivery, nil
+}
+
+func replayDelivery(original WebhookDelivery, now time.Time) WebhookDelivery {
+	return WebhookDelivery{
+		ID:          primitive.NewObjectID(),
+		Webhook:     original.Webhook,
+		Event:       original.Event,
+		Payload:     original.Payload,
+		Status:      DeliveryStatus.Pending,
+		NextAttempt: now,
+		ReplayOf:    original.ID,
+		CreatedAt:   now,
+	}
+}
+
+// DeliverDueWebhooks sends the deliveries whose time has come. A failed
+// delivery is retried with exponential backoff until it has been attempted
+// maxWebhookAttempts times.
+func DeliverDueWebhooks(client *http.Client) error {
+	collection := GetCollection("webhookdeliveries")
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		var delivery WebhookDelivery
+		// a delivery left sending by an instance that stopped is picked up
+		// again once its claim expires
+		filter := bson.M{
+			"status":      bson.M{"$in": []string{DeliveryStatus.Pending, DeliveryStatus.Sending}},
+			"nextAttempt": bson.M{"$lte": time.Now()},
+		}
+		update := bson.M{
+			"$set": bson.M{"status": DeliveryStatus.Sending, "nextAttempt": time.Now().Add(5 * time.Minute)},
+			"$inc": bson.M{"attempts": 1},
+		}
+		opts := options.FindOneAndUpdate().SetSort(bson.M{"nextAttempt": 1}).SetReturnDocument(options.After)
+		err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&delivery)
+		cancel()
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// a deleted webhook is left zero and fails like a disabled one
+		hook, _ := GetWebhookByID(delivery.Webhook)
+		result := attemptWebhook(client, hook, delivery, time.Now())
+
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		collection.UpdateByID(ctx, delivery.ID, bson.M{"$set": result})
+		cancel()
+	}
+}
+
+// attemptWebhook sends a claimed delivery and returns the fields to record.
+// Deliveries to a deleted or disabled webhook fail without being retried,
+// except pings which are sent to disabled webhooks too.
+func attemptWebhook(client *http.Client, hook Webhook, delivery WebhookDelivery, now time.Time) bson.M {
+	result := bson.M{}
+	enabled := hook.Active || (delivery.Event == WebhookEvent.Ping && !hook.ID.IsZero())
+	var err error
+	if enabled {
+		var status int
+		status, err = sendWebhook(client, hook, delivery)
+		result["responseStatus"] = status
+	} else if hook.ID.IsZero() {
+		err = fmt.Errorf("webhook was deleted")
+	} else {
+		err = fmt.Errorf("webhook is disabled")
+	}
+	if err == nil {
+		result["status"] = DeliveryStatus.Sent
+		result["deliveredAt"] = now
+		result["error"] = ""
+		return result
+	}
+
+	result["status"] = DeliveryStatus.Failed
+	result["error"] = err.Error()
+	if enabled && delivery.Attempts < maxWebhookAttempts {
+		result["status"] = DeliveryStatus.Pending
+		result["nextAttempt"] = now.Add(webhookRetryBase << (delivery.Attempts - 1))
+	}
+	return result
+}
+
+// sendWebhook posts a signed delivery and returns the response status. Any
+// status outside 2xx is a failure.
+func sendWebhook(client *http.Client, hook Webhook, delivery WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Hermes-Webhooks/1.0")
+	req.Header.Set(helpers.WebhookEventHeader, delivery.Event)
+	req.Header.Set(helpers.WebhookDeliveryHeader, delivery.ID.Hex())
+	req.Header.Set(helpers.WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(helpers.WebhookSignatureHeader, helpers.SignWebhookPayload(hook.Secret, timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// StartWebhookDelivery delivers queued webhook events every interval, or as
+// soon as an event is emitted.
+func StartWebhookDelivery(interval time.Duration) {
+	client := &http.Client{Timeout: webhookTimeout}
+	go func() {
+		for {
+			if err := DeliverDueWebhooks(client); err != nil {
+				log.Printf("Failed to deliver webhooks: %v", err)
+			}
+			select {
+			case <-webhookWake:
+			case <-time.After(interval):
+			}
+		}
+	}()
+}
@@ -0,0 +1,189 @@
+package database
+
+import (
+	"hermes/helpers"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// webhookReceiver records the requests it gets and answers them with the
+// queued statuses, then 200.
+type webhookReceiver struct {
+	t      *testing.T
+	secret string
+	server *httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	received []receivedWebhook
+}
+
+type receivedWebhook struct {
+	event    string
+	delivery string
+	body     string
+}
+
+func newWebhookReceiver(t *testing.T, secret string, statuses ...int) *webhookReceiver {
+	receiver := &webhookReceiver{t: t, secret: secret, statuses: statuses}
+	receiver.server = httptest.NewServer(http.HandlerFunc(receiver.serve))
+	t.Cleanup(receiver.server.Close)
+	return receiver
+}
+
+func (r *webhookReceiver) serve(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	timestamp, err := strconv.ParseInt(req.Header.Get(helpers.WebhookTimestampHeader), 10, 64)
+	if err != nil || time.Since(time.Unix(timestamp, 0)) > 5*time.Minute {
+		r.t.Errorf("bad timestamp %q", req.Header.Get(helpers.WebhookTimestampHeader))
+	}
+	if !helpers.VerifyWebhookSignature(r.secret, timestamp, body, req.Header.Get(helpers.WebhookSignatureHeader)) {
+		r.t.Errorf("signature %q does not verify", req.Header.Get(helpers.WebhookSignatureHeader))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.received = append(r.received, receivedWebhook{
+		event:    req.Header.Get(helpers.WebhookEventHeader),
+		delivery: req.Header.Get(helpers.WebhookDeliveryHeader),
+		body:     string(body),
+	})
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (r *webhookReceiver) requests() []receivedWebhook {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]receivedWebhook(nil), r.received...)
+}
+
+func testWebhook(url string, active bool) (Webhook, WebhookDelivery) {
+	hook := Webhook{ID: primitive.NewObjectID(), URL: url, Secret: "secret", Active: active}
+	delivery := WebhookDelivery{
+		ID:       primitive.NewObjectID(),
+		Webhook:  hook.ID,
+		Event:    WebhookEvent.GradePosted,
+		Payload:  `{"id":"event-1","event":"grade.posted"}`,
+		Status:   DeliveryStatus.Sending,
+		Attempts: 1,
+	}
+	return hook, delivery
+}
+
+func TestWebhookDeliverySignedAndRetried(t *testing.T) {
+	receiver := newWebhookReceiver(t, "secret", http.StatusBadGateway, http.StatusServiceUnavailable)
+	hook, delivery := testWebhook(receiver.server.URL, true)
+	client := receiver.server.Client()
+	now := time.Now()
+
+	result := attemptWebhook(client, hook, delivery, now)
+	if result["status"] != DeliveryStatus.Pending || result["responseStatus"] != http.StatusBadGateway {
+		t.Fatalf("5xx was not scheduled for a retry: %v", result)
+	}
+	if result["nextAttempt"] != now.Add(webhookRetryBase) {
+		t.Fatalf("first retry at %v, want %v", result["nextAttempt"], now.Add(webhookRetryBase))
+	}
+
+	delivery.Attempts = 3
+	result = attemptWebhook(client, hook, delivery, now)
+	if result["status"] != DeliveryStatus.Pending || result["nextAttempt"] != now.Add(4*webhookRetryBase) {
+		t.Fatalf("retry did not back off: %v", result)
+	}
+
+	delivery.Attempts = 4
+	result = attemptWebhook(client, hook, delivery, now)
+	if result["status"] != DeliveryStatus.Sent || result["responseStatus"] != http.StatusOK {
+		t.Fatalf("2xx was not recorded as sent: %v", result)
+	}
+
+	requests := receiver.requests()
+	if len(requests) != 3 {
+		t.Fatalf("receiver got %d requests, want 3", len(requests))
+	}
+	for _, req := range requests {
+		if req.event != delivery.Event || req.delivery != delivery.ID.Hex() || req.body != delivery.Payload {
+			t.Fatalf("unexpected request: %+v", req)
+		}
+	}
+}
+
+func TestWebhookDeliveryGivesUp(t *testing.T) {
+	receiver := newWebhookReceiver(t, "secret", http.StatusInternalServerError)
+	hook, delivery := testWebhook(receiver.server.URL, true)
+	delivery.Attempts = maxWebhookAttempts
+
+	result := attemptWebhook(receiver.server.Client(), hook, delivery, time.Now())
+	if result["status"] != DeliveryStatus.Failed {
+		t.Fatalf("delivery was retried after %d attempts: %v", maxWebhookAttempts, result)
+	}
+	if _, ok := result["nextAttempt"]; ok {
+		t.Fatalf("failed delivery was rescheduled: %v", result)
+	}
+}
+
+func TestWebhookDeliveryToDisabledWebhook(t *testing.T) {
+	receiver := newWebhookReceiver(t, "secret")
+	hook, delivery := testWebhook(receiver.server.URL, false)
+	client := receiver.server.Client()
+
+	result := attemptWebhook(client, hook, delivery, time.Now())
+	if result["status"] != DeliveryStatus.Failed {
+		t.Fatalf("delivery to a disabled webhook was not failed: %v", result)
+	}
+	result = attemptWebhook(client, Webhook{}, delivery, time.Now())
+	if result["status"] != DeliveryStatus.Failed {
+		t.Fatalf("delivery to a deleted webhook was not failed: %v", result)
+	}
+	if len(receiver.requests()) != 0 {
+		t.Fatal("a disabled webhook received a delivery")
+	}
+
+	// pings still reach a disabled webhook so its receiver can be checked
+	delivery.Event = WebhookEvent.Ping
+	result = attemptWebhook(client, hook, delivery, time.Now())
+	if result["status"] != DeliveryStatus.Sent || len(receiver.requests()) != 1 {
+		t.Fatalf("ping to a disabled webhook was not sent: %v", result)
+	}
+}
+
+func TestWebhookReplay(t *testing.T) {
+	receiver := newWebhookReceiver(t, "secret")
+	hook, original := testWebhook(receiver.server.URL, true)
+	client := receiver.server.Client()
+
+	if result := attemptWebhook(client, hook, original, time.Now()); result["status"] != DeliveryStatus.Sent {
+		t.Fatalf("original delivery failed: %v", result)
+	}
+	replay := replayDelivery(original, time.Now())
+	if replay.ID == original.ID || replay.ReplayOf != original.ID || replay.Status != DeliveryStatus.Pending {
+		t.Fatalf("unexpected replay: %+v", replay)
+	}
+	replay.Attempts = 1
+	if result := attemptWebhook(client, hook, replay, time.Now()); result["status"] != DeliveryStatus.Sent {
+		t.Fatalf("replayed delivery failed: %v", result)
+	}
+
+	requests := receiver.requests()
+	if len(requests) != 2 {
+		t.Fatalf("receiver got %d requests, want 2", len(requests))
+	}
+	// the payload and its event id are unchanged so the receiver can
+	// recognise the replay, only the delivery id differs
+	if requests[1].body != requests[0].body || requests[1].event != requests[0].event {
+		t.Fatalf("replay changed the payload: %+v", requests)
+	}
+	if requests[1].delivery == requests[0].delivery {
+		t.Fatal("replay reused the delivery id")
+	}
+}
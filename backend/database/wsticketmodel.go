@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hermes/helpers"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// WebSocketTicketTTL is how long a WebSocket ticket can be redeemed.
+const WebSocketTicketTTL = 30 * time.Second
+
+// WebSocketTicket lets a browser open a WebSocket, which cannot carry an
+// Authorization header, without putting its bearer token in the URL where
+// access logs would record it. Tickets are stored hashed, expire quickly and
+// are redeemed once.
+type WebSocketTicket struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	Hash      string             `bson:"hash"`
+	User      primitive.ObjectID `bson:"user"`
+	Session   primitive.ObjectID `bson:"session,omitempty"`
+	ExpiresAt time.Time          `bson:"expiresAt"`
+}
+
+// CreateWebSocketTicket issues a ticket for the user and returns it in the
+// clear, only its hash is kept.
+func CreateWebSocketTicket(userID primitive.ObjectID, sessionID primitive.ObjectID) (string, error) {
+	collection := GetCollection("wstickets")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	raw := strings.TrimRight(helpers.GenerateRandomToken(32), "=")
+	ticket := WebSocketTicket{
+		ID:        primitive.NewObjectID(),
+		Hash:      hashWebSocketTicket(raw),
+		User:      userID,
+		Session:   sessionID,
+		ExpiresAt: time.Now().Add(WebSocketTicketTTL),
+	}
+	if _, err := collection.InsertOne(ctx, ticket); err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// ConsumeWebSocketTicket returns the ticket and deletes it so it can never
+// be redeemed twice.
+func ConsumeWebSocketTicket(raw string) (WebSocketTicket, error) {
+	var ticket WebSocketTicket
+	collection := GetCollection("wstickets")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := collection.FindOneAndDelete(ctx, bson.M{"hash": hashWebSocketTicket(raw)}).Decode(&ticket)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return ticket, fmt.Errorf("unknown ticket")
+		}
+		return ticket, err
+	}
+	if time.Now().After(ticket.ExpiresAt) {
+		return ticket, fmt.Errorf("ticket expired")
+	}
+	return ticket, nil
+}
+
+func hashWebSocketTicket(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,26 +1,62 @@
 package helpers
 
-import "gopkg.in/gomail.v2"
+import (
+	"os"
+	"strconv"
+
+	"gopkg.in/gomail.v2"
+)
 
 type Sender interface {
 	SendPasswordResetEmail(to, resetLink string) error
+	// Send renders the named email template with data and sends it.
+	Send(to, subject, template string, data interface{}) error
 }
 type smtpSender struct {
 	dialer *gomail.Dialer
+	from   string
 }
 
 func InitSMTPSender(host string, port int, username, password string) Sender {
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = "noreply@hermes.com"
+	}
 	return &smtpSender{
 		dialer: gomail.NewDialer(host, port, username, password),
+		from:   from,
+	}
+}
+
+// NewSenderFromEnv builds a sender from SMTP_HOST, SMTP_PORT, SMTP_EMAIL and
+// SMTP_PASSWORD. It returns nil when SMTP is not configured.
+func NewSenderFromEnv() Sender {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return nil
 	}
+	port, err := strconv.Atoi(os.Getenv("SMTP_PORT"))
+	if err != nil {
+		port = 587
+	}
+	return InitSMTPSender(host, port, os.Getenv("SMTP_EMAIL"), os.Getenv("SMTP_PASSWORD"))
 }
 
 func (s *smtpSender) SendPasswordResetEmail(to, resetLink string) error {
+	return s.Send(to, "Password Reset Request", "password_reset", struct{ Link string }{resetLink})
+}
+
+func (s *smtpSender) Send(to, subject, template string, data interface{}) error {
+	body, err := RenderEmail(template, data)
+	if err != nil {
+		return err
+	}
+
 	m := gomail.NewMessage()
-	m.SetHeader("From", "noreply@hermes.com")
+	m.SetHeader("From", s.from)
 	m.SetHeader("To", to)
-	m.SetHeader("Subject", "Password Reset Request")
-	m.SetBody("text/html", GetEmailBodyContent(resetLink))
+	m.SetHeader("Subject", subject)
+	m.SetBody("text/html", body)
 
 	return s.dialer.DialAndSend(m)
 }
@@ -0,0 +1,146 @@
+package helpers
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"time"
+)
+
+// emailLayout wraps the content of every email. Each email template defines
+// "title" and "content".
+const emailLayout = `{{define "layout"}}
+<!DOCTYPE html>
+<html lang="en">
+	<head>
+		<meta charset="UTF-8">
+		<meta name="viewport" content="width=device-width, initial-scale=1.0">
+		<title>{{template "title" .}}</title>
+		<style>
+			body {
+				font-family: Arial, sans-serif;
+				line-height: 1.6;
+				color: #333;
+				background-color: #f4f4f4;
+				margin: 0;
+				padding: 0;
+			}
+			.container {
+				max-width: 600px;
+				margin: 20px auto;
+				padding: 20px;
+				background-color: #ffffff;
+				border-radius: 8px;
+				box-shadow: 0 0 10px rgba(0, 0, 0, 0.1);
+			}
+			h2 {
+				color: #4a4a4a;
+				border-bottom: 2px solid #007bff;
+				padding-bottom: 10px;
+			}
+			.btn {
+				display: inline-block;
+				padding: 12px 24px;
+				background-color: #9266f7;
+				color: #ffffff;
+				text-decoration: none;
+				border-radius: 5px;
+				font-weight: bold;
+				transition: background-color 0.3s ease;
+			}
+			.btn:hover {
+				background-color: #0056b3;
+			}
+			.link {
+				word-break: break-all;
+				color: #007bff;
+			}
+			.item {
+				padding: 10px 0;
+				border-bottom: 1px solid #eee;
+			}
+			.meta {
+				font-size: 0.85em;
+				color: #666;
+			}
+			.footer {
+				margin-top: 20px;
+				padding-top: 20px;
+				border-top: 1px solid #eee;
+				font-size: 0.9em;
+				color: #666;
+			}
+		</style>
+	</head>
+	<body>
+		<div class="container">
+			<h2>{{template "title" .}}</h2>
+			{{template "content" .}}
+			<div class="footer">
+				<p>Best regards,<br>Hermes Team</p>
+				<p>© {{year}} Hermes. All rights reserved.</p>
+			</div>
+		</div>
+	</body>
+</html>
+{{end}}`
+
+var emailTemplates = map[string]string{
+	"password_reset": `
+{{define "title"}}Password Reset Request{{end}}
+{{define "content"}}
+<p>We received a request to reset your password. If you didn't make this request, you can ignore this email.</p>
+<p>To reset your password, please click the button below:</p>
+<p style="text-align: center;">
+	<a href="{{.Link}}" class="btn">Reset Password</a>
+</p>
+<p>If the button doesn't work, you can also copy and paste the following link into your browser:</p>
+<p class="link">{{.Link}}</p>
+<p><strong>Note:</strong> This link will expire in 20 minutes for security reasons.</p>
+<p>If you have any questions or need assistance, please don't hesitate to contact our support team.</p>
+{{end}}`,
+	"notifications": `
+{{define "title"}}{{.Title}}{{end}}
+{{define "content"}}
+<p>Hi {{.Name}},</p>
+{{range .Items}}
+<div class="item">
+	<div>{{.Message}}</div>
+	<div class="meta">{{.Author}} · {{.Time.Format "Jan 2, 15:04"}}</div>
+</div>
+{{end}}
+<p class="meta">You can change how you receive notifications in your notification settings.</p>
+{{end}}`,
+}
+
+var parsedEmailTemplates = parseEmailTemplates()
+
+func parseEmailTemplates() map[string]*template.Template {
+	funcs := template.FuncMap{"year": func() string { return time.Now().Format("2006") }}
+	parsed := map[string]*template.Template{}
+	for name, body := range emailTemplates {
+		t := template.Must(template.New(name).Funcs(funcs).Parse(emailLayout))
+		parsed[name] = template.Must(t.Parse(body))
+	}
+	return parsed
+}
+
+// RenderEmail renders a named email template with data.
+func RenderEmail(name string, data interface{}) (string, error) {
+	t, ok := parsedEmailTemplates[name]
+	if !ok {
+		return "", fmt.Errorf("unknown email template %q", name)
+	}
+	var body bytes.Buffer
+	if err := t.ExecuteTemplate(&body, "layout", data); err != nil {
+		return "", err
+	}
+	return body.String(), nil
+}
+
+// NotificationEmail is the data of the notifications template.
+type NotificationEmail struct {
+	Title string
+	Name  string
+	Items []Notification
+}
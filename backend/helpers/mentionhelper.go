@@ -0,0 +1,32 @@
+package helpers
+
+import (
+	"regexp"
+	"strings"
+)
+
+const maxMentions = 20
+
+// mentionRegex matches @username not preceded by a word character, so email
+// addresses are not taken for mentions.
+var mentionRegex = regexp.MustCompile(`(^|[^\w@])@([\w.-]+)`)
+
+// ParseMentions returns the distinct usernames mentioned in content, in the
+// order they appear.
+func ParseMentions(content string) []string {
+	usernames := []string{}
+	seen := map[string]bool{}
+	for _, match := range mentionRegex.FindAllStringSubmatch(content, -1) {
+		// a trailing dot or dash ends the sentence rather than the name
+		username := strings.TrimRight(match[2], ".-")
+		if username == "" || seen[username] {
+			continue
+		}
+		seen[username] = true
+		usernames = append(usernames, username)
+		if len(usernames) == maxMentions {
+			break
+		}
+	}
+	return usernames
+}
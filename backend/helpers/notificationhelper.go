@@ -2,23 +2,47 @@ package helpers
 
 import (
 	"fmt"
+	"log"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-var NotificationChannel = make(chan Notification)
-
 var (
 	SystemAlertsChannelID, _  = primitive.ObjectIDFromHex("64faec9bf6d7d9c54b4d7e33")
 	AnnouncementsChannelID, _ = primitive.ObjectIDFromHex("64faec9bf6d7d9c54b4d7e44")
 )
 
+// Notification is sent to everyone subscribed to the channel ObjectID, which
+// is a user for personal notifications or a tribune, course or system
+// channel.
 type Notification struct {
-	ObjectID primitive.ObjectID `json:"object_id"`
-	Message  string             `json:"message"`
-	Author   string             `json:"author"`
-	Time     time.Time          `json:"time"`
+	ID       primitive.ObjectID `bson:"_id" json:"id"`
+	ObjectID primitive.ObjectID `bson:"channel" json:"object_id"`
+	Message  string             `bson:"message" json:"message"`
+	Author   string             `bson:"author" json:"author"`
+	Time     time.Time          `bson:"time" json:"time"`
+	// Seq numbers stored notifications in the order they were saved, across
+	// every instance. Live events that are not stored have none.
+	Seq int64 `bson:"seq,omitempty" json:"seq,omitempty"`
+	// Event and Data carry structured updates, such as live poll results,
+	// that clients apply instead of showing the message.
+	Event string      `bson:"-" json:"event,omitempty"`
+	Data  interface{} `bson:"-" json:"data,omitempty"`
+}
+
+// NotificationStore persists notifications so they can be read later from
+// the inbox.
+type NotificationStore interface {
+	SaveNotification(notification *Notification) error
+}
+
+var notificationStore NotificationStore
+
+// SetNotificationStore installs the store every notification is written to
+// before it is published.
+func SetNotificationStore(store NotificationStore) {
+	notificationStore = store
 }
 
 func SendNotification(objectID primitive.ObjectID, author string, format string, args ...interface{}) {
@@ -28,10 +52,50 @@ func SendNotification(objectID primitive.ObjectID, author string, format string,
 	}
 
 	notification := Notification{
+		ID:       primitive.NewObjectID(),
 		ObjectID: objectID,
 		Message:  message,
 		Author:   author,
 		Time:     time.Now(),
 	}
-	NotificationChannel <- notification
+	if notificationStore != nil {
+		if err := notificationStore.SaveNotification(&notification); err != nil {
+			log.Printf("failed to store notification: %v", err)
+		}
+	}
+	Notifications.Publish(notification)
+}
+
+// SubscriptionsChangedEvent is sent on a user's own channel when the
+// channels they are subscribed to change, so open streams can follow.
+const SubscriptionsChangedEvent = "subscriptions"
+
+// SendEvent pushes a structured update to the subscribers of objectID.
+// Events describe live state and are not kept in the inbox.
+func SendEvent(objectID primitive.ObjectID, event string, data interface{}) {
+	Notifications.Publish(Notification{
+		ID:       primitive.NewObjectID(),
+		ObjectID: objectID,
+		Author:   "System",
+		Time:     time.Now(),
+		Event:    event,
+		Data:     data,
+	})
+}
+
+// TribuneStreams carries live tribune traffic, such as new messages and
+// typing indicators, to WebSocket clients. It is separate from Notifications
+// so chat traffic never reaches the inbox or the SSE stream.
+var TribuneStreams = newHubFromEnv()
+
+// SendTribuneEvent pushes a live update to the clients following a tribune.
+func SendTribuneEvent(tribuneID primitive.ObjectID, event string, data interface{}) {
+	TribuneStreams.Publish(Notification{
+		ID:       primitive.NewObjectID(),
+		ObjectID: tribuneID,
+		Author:   "System",
+		Time:     time.Now(),
+		Event:    event,
+		Data:     data,
+	})
 }
@@ -0,0 +1,245 @@
+package helpers
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DropPolicy decides what a publish does when a subscriber's buffer is full.
+type DropPolicy int
+
+const (
+	// DropOldest discards the oldest buffered notification to make room.
+	DropOldest DropPolicy = iota
+	// DropNewest discards the notification being published.
+	DropNewest
+	// Disconnect closes the subscription of a subscriber that cannot keep
+	// up, so the client reconnects and catches up.
+	Disconnect
+)
+
+const defaultSubscriptionBuffer = 64
+
+// Hub fans notifications out to every subscription listening on their
+// channel id. Publishing never blocks.
+type Hub struct {
+	mu     sync.RWMutex
+	subs   map[primitive.ObjectID]map[*Subscription]struct{}
+	buffer int
+	policy DropPolicy
+	bus    Bus
+	topic  string
+}
+
+// Subscription receives the notifications of a set of channels until it is
+// closed.
+type Subscription struct {
+	hub      *Hub
+	ch       chan Notification
+	channels []primitive.ObjectID
+	dropped  atomic.Int64
+	closed   bool
+}
+
+func NewHub(buffer int, policy DropPolicy) *Hub {
+	if buffer <= 0 {
+		buffer = defaultSubscriptionBuffer
+	}
+	return &Hub{
+		subs:   map[primitive.ObjectID]map[*Subscription]struct{}{},
+		buffer: buffer,
+		policy: policy,
+	}
+}
+
+// newHubFromEnv reads NOTIFICATION_BUFFER and NOTIFICATION_DROP_POLICY
+// ("oldest", "newest" or "disconnect").
+func newHubFromEnv() *Hub {
+	buffer, _ := strconv.Atoi(os.Getenv("NOTIFICATION_BUFFER"))
+	policy := DropOldest
+	switch os.Getenv("NOTIFICATION_DROP_POLICY") {
+	case "newest":
+		policy = DropNewest
+	case "disconnect":
+		policy = Disconnect
+	}
+	return NewHub(buffer, policy)
+}
+
+// Notifications is the hub every notification of the application goes
+// through.
+var Notifications = newHubFromEnv()
+
+// Subscribe starts listening on the given channels.
+func (h *Hub) Subscribe(channels ...primitive.ObjectID) *Subscription {
+	sub := &Subscription{hub: h, ch: make(chan Notification, h.buffer)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, channel := range channels {
+		if _, dup := h.subs[channel][sub]; dup {
+			continue
+		}
+		if h.subs[channel] == nil {
+			h.subs[channel] = map[*Subscription]struct{}{}
+		}
+		h.subs[channel][sub] = struct{}{}
+		sub.channels = append(sub.channels, channel)
+	}
+	return sub
+}
+
+// Bus carries notifications between the instances of the backend. Each
+// instance delivers its own notifications locally and relays them on the
+// bus, so a bus only needs to hand the others what it receives.
+type Bus interface {
+	Publish(topic string, notification Notification)
+	Subscribe(topic string, deliver func(Notification))
+}
+
+// UseBus relays the hub's notifications to the other instances through bus
+// and delivers theirs locally.
+func (h *Hub) UseBus(bus Bus, topic string) {
+	h.mu.Lock()
+	h.bus = bus
+	h.topic = topic
+	h.mu.Unlock()
+	bus.Subscribe(topic, func(notification Notification) {
+		h.deliver(notification)
+	})
+}
+
+// Publish delivers a notification to the local subscribers of its channel,
+// relays it to the other instances when a bus is in use, and returns how
+// many local subscribers received it. Delivery never waits on the bus, so
+// local subscribers are still served when it is down.
+func (h *Hub) Publish(notification Notification) int {
+	delivered := h.deliver(notification)
+
+	h.mu.RLock()
+	bus, topic := h.bus, h.topic
+	h.mu.RUnlock()
+	if bus != nil {
+		bus.Publish(topic, notification)
+	}
+	return delivered
+}
+
+func (h *Hub) deliver(notification Notification) int {
+	var slow []*Subscription
+	delivered := 0
+
+	h.mu.RLock()
+	for sub := range h.subs[notification.ObjectID] {
+		if sub.offer(notification, h.policy) {
+			delivered++
+		} else if h.policy == Disconnect {
+			slow = append(slow, sub)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, sub := range slow {
+		sub.Close()
+	}
+	return delivered
+}
+
+// offer hands a notification to the subscription without blocking. It must
+// be called with the hub's read lock held so the channel cannot be closed
+// underneath it.
+func (s *Subscription) offer(notification Notification, policy DropPolicy) bool {
+	select {
+	case s.ch <- notification:
+		return true
+	default:
+	}
+	s.dropped.Add(1)
+	if policy != DropOldest {
+		return false
+	}
+	// make room by discarding the oldest buffered notification, another
+	// publisher may have filled the slot again in the meantime
+	for attempt := 0; attempt < 3; attempt++ {
+		select {
+		case <-s.ch:
+		default:
+		}
+		select {
+		case s.ch <- notification:
+			return true
+		default:
+		}
+	}
+	return false
+}
+
+// Events is the stream of notifications. It is closed when the subscription
+// is closed.
+func (s *Subscription) Events() <-chan Notification {
+	return s.ch
+}
+
+// Dropped is the number of notifications lost because the buffer was full.
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Close stops the subscription and releases it from the hub. It is safe to
+// call more than once.
+func (s *Subscription) Close() {
+	h := s.hub
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	for _, channel := range s.channels {
+		set := h.subs[channel]
+		delete(set, s)
+		if len(set) == 0 {
+			delete(h.subs, channel)
+		}
+	}
+	close(s.ch)
+}
+
+// SetChannels replaces the channels the subscription listens on.
+func (s *Subscription) SetChannels(channels ...primitive.ObjectID) {
+	h := s.hub
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s.closed {
+		return
+	}
+	for _, channel := range s.channels {
+		set := h.subs[channel]
+		delete(set, s)
+		if len(set) == 0 {
+			delete(h.subs, channel)
+		}
+	}
+	s.channels = nil
+	for _, channel := range channels {
+		if _, dup := h.subs[channel][s]; dup {
+			continue
+		}
+		if h.subs[channel] == nil {
+			h.subs[channel] = map[*Subscription]struct{}{}
+		}
+		h.subs[channel][s] = struct{}{}
+		s.channels = append(s.channels, channel)
+	}
+}
+
+// Subscribers is the number of subscriptions listening on a channel.
+func (h *Hub) Subscribers(channel primitive.ObjectID) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subs[channel])
+}
@@ -0,0 +1,356 @@
+package helpers
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	GroupsClaim  string
+	// RoleMapping maps an IdP group name to a hermes role.
+	RoleMapping   map[string]string
+	AutoProvision bool
+	// RequireVerifiedEmail refuses to provision new accounts for emails the
+	// IdP has not verified. Linking an existing account by email always needs
+	// a verified email.
+	RequireVerifiedEmail bool
+}
+
+type OIDCProvider struct {
+	Config OIDCConfig
+
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	IssuerURL             string `json:"issuer"`
+
+	client *http.Client
+	mu     sync.RWMutex
+	keys   map[string]*rsa.PublicKey
+}
+
+type OIDCTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+type OIDCClaims struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+	Groups            []string
+}
+
+var (
+	oidcProvider *OIDCProvider
+	oidcMu       sync.Mutex
+)
+
+// LoadOIDCConfig reads the identity provider settings from the environment.
+// OIDC_ROLE_MAPPING has the form "idp-group=role,other-group=role".
+func LoadOIDCConfig() OIDCConfig {
+	config := OIDCConfig{
+		Issuer:        strings.TrimSuffix(os.Getenv("OIDC_ISSUER"), "/"),
+		ClientID:      os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret:  os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:   os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:        []string{"openid", "email", "profile"},
+		GroupsClaim:   os.Getenv("OIDC_GROUPS_CLAIM"),
+		RoleMapping:   map[string]string{},
+		AutoProvision: os.Getenv("OIDC_AUTO_PROVISION") != "false",
+
+		RequireVerifiedEmail: os.Getenv("OIDC_REQUIRE_VERIFIED_EMAIL") == "true",
+	}
+	if scopes := os.Getenv("OIDC_SCOPES"); scopes != "" {
+		config.Scopes = strings.Fields(strings.ReplaceAll(scopes, ",", " "))
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = "groups"
+	}
+	for _, pair := range strings.Split(os.Getenv("OIDC_ROLE_MAPPING"), ",") {
+		group, role, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if found && group != "" && role != "" {
+			config.RoleMapping[group] = role
+		}
+	}
+	return config
+}
+
+// GetOIDCProvider returns the provider described by the environment, running
+// discovery against the issuer the first time it is called.
+func GetOIDCProvider() (*OIDCProvider, error) {
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+	if oidcProvider != nil {
+		return oidcProvider, nil
+	}
+
+	config := LoadOIDCConfig()
+	if config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+		return nil, fmt.Errorf("single sign-on is not configured")
+	}
+	// a failed discovery is not cached so a later request can retry it
+	provider, err := NewOIDCProvider(config)
+	if err != nil {
+		return nil, err
+	}
+	oidcProvider = provider
+	return oidcProvider, nil
+}
+
+func NewOIDCProvider(config OIDCConfig) (*OIDCProvider, error) {
+	provider := &OIDCProvider{
+		Config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+		keys:   make(map[string]*rsa.PublicKey),
+	}
+
+	resp, err := provider.client.Get(config.Issuer + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch provider configuration: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch provider configuration: status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(provider); err != nil {
+		return nil, fmt.Errorf("failed to decode provider configuration: %v", err)
+	}
+	if strings.TrimSuffix(provider.IssuerURL, "/") != config.Issuer {
+		return nil, fmt.Errorf("issuer mismatch: expected %s, got %s", config.Issuer, provider.IssuerURL)
+	}
+	return provider, nil
+}
+
+// GeneratePKCE returns a code verifier and its S256 code challenge.
+func GeneratePKCE() (string, string) {
+	verifier := strings.TrimRight(GenerateRandomToken(48), "=")
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (p *OIDCProvider) AuthCodeURL(state, nonce, challenge string) string {
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.Config.ClientID},
+		"redirect_uri":          {p.Config.RedirectURL},
+		"scope":                 {strings.Join(p.Config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.AuthorizationEndpoint + separator + params.Encode()
+}
+
+func (p *OIDCProvider) Exchange(code, verifier string) (OIDCTokenResponse, error) {
+	var tokens OIDCTokenResponse
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.Config.RedirectURL},
+		"client_id":     {p.Config.ClientID},
+		"code_verifier": {verifier},
+	}
+	if p.Config.ClientSecret != "" {
+		form.Set("client_secret", p.Config.ClientSecret)
+	}
+
+	resp, err := p.client.PostForm(p.TokenEndpoint, form)
+	if err != nil {
+		return tokens, fmt.Errorf("failed to reach token endpoint: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return tokens, fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return tokens, fmt.Errorf("failed to decode token response: %v", err)
+	}
+	if tokens.IDToken == "" {
+		return tokens, fmt.Errorf("token response did not contain an id_token")
+	}
+	return tokens, nil
+}
+
+// VerifyIDToken checks the signature, issuer, audience, expiry and nonce of
+// an ID token and returns the claims hermes cares about.
+func (p *OIDCProvider) VerifyIDToken(rawToken, nonce string) (OIDCClaims, error) {
+	var claims OIDCClaims
+	token, err := jwt.Parse(rawToken, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(kid)
+	})
+	if err != nil {
+		return claims, fmt.Errorf("invalid id_token: %v", err)
+	}
+	mapClaims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return claims, fmt.Errorf("invalid id_token")
+	}
+	if !mapClaims.VerifyIssuer(p.IssuerURL, true) {
+		return claims, fmt.Errorf("id_token issuer mismatch")
+	}
+	if !mapClaims.VerifyAudience(p.Config.ClientID, true) && !audienceContains(mapClaims["aud"], p.Config.ClientID) {
+		return claims, fmt.Errorf("id_token audience mismatch")
+	}
+	if !mapClaims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return claims, fmt.Errorf("id_token expired")
+	}
+	if tokenNonce, _ := mapClaims["nonce"].(string); tokenNonce != nonce {
+		return claims, fmt.Errorf("id_token nonce mismatch")
+	}
+
+	claims.Subject, _ = mapClaims["sub"].(string)
+	claims.Email, _ = mapClaims["email"].(string)
+	claims.Name, _ = mapClaims["name"].(string)
+	claims.PreferredUsername, _ = mapClaims["preferred_username"].(string)
+	switch verified := mapClaims["email_verified"].(type) {
+	case bool:
+		claims.EmailVerified = verified
+	case string:
+		claims.EmailVerified = verified == "true"
+	}
+	switch groups := mapClaims[p.Config.GroupsClaim].(type) {
+	case []interface{}:
+		for _, group := range groups {
+			if name, ok := group.(string); ok {
+				claims.Groups = append(claims.Groups, name)
+			}
+		}
+	case string:
+		claims.Groups = strings.Fields(strings.ReplaceAll(groups, ",", " "))
+	}
+	if claims.Subject == "" {
+		return claims, fmt.Errorf("id_token has no subject")
+	}
+	return claims, nil
+}
+
+func audienceContains(aud interface{}, clientID string) bool {
+	list, ok := aud.([]interface{})
+	if !ok {
+		return false
+	}
+	for _, entry := range list {
+		if entry == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *OIDCProvider) publicKey(kid string) (*rsa.PublicKey, error) {
+	p.mu.RLock()
+	key, ok := p.keys[kid]
+	p.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	// unknown key id, the IdP may have rotated its keys
+	if err := p.refreshKeys(); err != nil {
+		return nil, err
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("signing key %q not found", kid)
+}
+
+func (p *OIDCProvider) refreshKeys() error {
+	resp, err := p.client.Get(p.JWKSURI)
+	if err != nil {
+		return fmt.Errorf("failed to fetch signing keys: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return fmt.Errorf("failed to decode signing keys: %v", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+	return nil
+}
+
+// MapGroupsToRole picks the most privileged hermes role granted by the
+// user's IdP groups, or "" when no group is mapped.
+func (p *OIDCProvider) MapGroupsToRole(groups []string, rolePriority []string) string {
+	granted := make(map[string]bool)
+	for _, group := range groups {
+		if role, ok := p.Config.RoleMapping[group]; ok {
+			granted[role] = true
+		}
+	}
+	for _, role := range rolePriority {
+		if granted[role] {
+			return role
+		}
+	}
+	return ""
+}
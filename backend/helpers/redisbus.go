@@ -0,0 +1,130 @@
+package helpers
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync/atomic"
+
+	"github.com/go-redis/redis"
+)
+
+const (
+	notificationsTopic  = "hermes:notifications"
+	tribuneStreamsTopic = "hermes:tribunes"
+	redisBusQueueSize   = 1024
+)
+
+// RedisBus relays notifications between instances with Redis pub/sub.
+// Publishing is queued and sent in the background so a slow or unavailable
+// Redis never holds up a request, notifications that cannot be relayed are
+// only delivered on the instance that sent them.
+type RedisBus struct {
+	client  *redis.Client
+	origin  string
+	queue   chan redisEnvelope
+	healthy atomic.Bool
+	dropped atomic.Int64
+}
+
+// redisEnvelope tags a notification with the instance that sent it, which
+// has already delivered it locally.
+type redisEnvelope struct {
+	Topic        string       `json:"topic"`
+	Origin       string       `json:"origin"`
+	Notification Notification `json:"notification"`
+}
+
+func NewRedisBus(redisUrl string) (*RedisBus, error) {
+	opt, err := redis.ParseURL(redisUrl)
+	if err != nil {
+		return nil, err
+	}
+	bus := &RedisBus{
+		client: redis.NewClient(opt),
+		origin: GenerateRandomToken(16),
+		queue:  make(chan redisEnvelope, redisBusQueueSize),
+	}
+	if err := bus.client.Ping().Err(); err != nil {
+		log.Printf("Redis is unavailable, notifications stay on this instance until it is back: %v", err)
+	} else {
+		bus.healthy.Store(true)
+	}
+	go bus.run()
+	return bus, nil
+}
+
+func (b *RedisBus) Publish(topic string, notification Notification) {
+	select {
+	case b.queue <- redisEnvelope{Topic: topic, Origin: b.origin, Notification: notification}:
+	default:
+		b.dropped.Add(1)
+	}
+}
+
+func (b *RedisBus) run() {
+	for envelope := range b.queue {
+		payload, err := json.Marshal(envelope)
+		if err != nil {
+			continue
+		}
+		err = b.client.Publish(envelope.Topic, payload).Err()
+		b.setHealthy(err)
+	}
+}
+
+// setHealthy logs when the connection to Redis is lost or comes back, not on
+// every failed publish.
+func (b *RedisBus) setHealthy(err error) {
+	if err == nil {
+		if !b.healthy.Swap(true) {
+			log.Println("Redis is available again, relaying notifications to other instances")
+		}
+		return
+	}
+	if b.healthy.Swap(false) {
+		log.Printf("Redis is unavailable, notifications stay on this instance: %v", err)
+	}
+}
+
+// Subscribe delivers the notifications other instances publish on topic. The
+// Redis client reconnects and resubscribes on its own after an outage.
+func (b *RedisBus) Subscribe(topic string, deliver func(Notification)) {
+	pubsub := b.client.Subscribe(topic)
+	go func() {
+		for message := range pubsub.Channel() {
+			var envelope redisEnvelope
+			if err := json.Unmarshal([]byte(message.Payload), &envelope); err != nil {
+				continue
+			}
+			if envelope.Origin == b.origin {
+				continue
+			}
+			deliver(envelope.Notification)
+		}
+	}()
+}
+
+// Dropped is the number of notifications not relayed because the queue was
+// full.
+func (b *RedisBus) Dropped() int64 {
+	return b.dropped.Load()
+}
+
+// ConnectNotificationBus relays notifications and tribune streams through
+// the Redis at REDIS_URL. Without it every instance only serves its own
+// clients, which is enough for a single replica.
+func ConnectNotificationBus() {
+	redisUrl := os.Getenv("REDIS_URL")
+	if redisUrl == "" {
+		log.Println("REDIS_URL is not set, notifications are delivered on this instance only")
+		return
+	}
+	bus, err := NewRedisBus(redisUrl)
+	if err != nil {
+		log.Printf("Invalid REDIS_URL, notifications are delivered on this instance only: %v", err)
+		return
+	}
+	Notifications.UseBus(bus, notificationsTopic)
+	TribuneStreams.UseBus(bus, tribuneStreamsTopic)
+}
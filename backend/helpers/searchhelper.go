@@ -0,0 +1,99 @@
+package helpers
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+const snippetRadius = 80
+
+// SearchTerms extracts the words of a text search query, ignoring negated
+// terms and the quotes around phrases.
+func SearchTerms(query string) []string {
+	terms := []string{}
+	for _, field := range strings.Fields(query) {
+		if strings.HasPrefix(field, "-") {
+			continue
+		}
+		words := strings.FieldsFunc(strings.ToLower(field), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		terms = append(terms, words...)
+	}
+	return terms
+}
+
+// Highlight cuts a snippet of text around the first matching term and wraps
+// every match in <mark> tags. The rest of the snippet is HTML escaped so it
+// can be rendered as is.
+func Highlight(text string, terms []string) string {
+	runes := []rune(text)
+	lower := []rune(strings.ToLower(text))
+	if len(lower) != len(runes) {
+		lower = runes
+	}
+
+	type match struct{ start, end int }
+	var matches []match
+	for i := 0; i < len(lower); {
+		if !isWordRune(lower[i]) || (i > 0 && isWordRune(lower[i-1])) {
+			i++
+			continue
+		}
+		end := i
+		for end < len(lower) && isWordRune(lower[end]) {
+			end++
+		}
+		if matchesTerm(string(lower[i:end]), terms) {
+			matches = append(matches, match{i, end})
+		}
+		i = end
+	}
+
+	from, to := 0, len(runes)
+	if len(matches) > 0 {
+		from = max(matches[0].start-snippetRadius, 0)
+	}
+	to = min(from+2*snippetRadius, len(runes))
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("...")
+	}
+	pos := from
+	for _, m := range matches {
+		if m.start < from || m.end > to {
+			continue
+		}
+		b.WriteString(html.EscapeString(string(runes[pos:m.start])))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(string(runes[m.start:m.end])))
+		b.WriteString("</mark>")
+		pos = m.end
+	}
+	b.WriteString(html.EscapeString(string(runes[pos:to])))
+	if to < len(runes) {
+		b.WriteString("...")
+	}
+	return b.String()
+}
+
+// matchesTerm compares words the way the text index stems them closely
+// enough for display: a shared prefix covering all but a short suffix.
+func matchesTerm(word string, terms []string) bool {
+	for _, term := range terms {
+		stem := []rune(term)
+		if len(stem) > 4 {
+			stem = stem[:len(stem)-2]
+		}
+		if strings.HasPrefix(word, string(stem)) && len([]rune(word))-len(stem) <= 4 {
+			return true
+		}
+	}
+	return false
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,32 @@
+package helpers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+)
+
+// Webhook requests carry these headers. The signature is
+// "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body)), receivers
+// recompute it and reject old timestamps to stop replayed requests.
+const (
+	WebhookEventHeader     = "X-Hermes-Event"
+	WebhookDeliveryHeader  = "X-Hermes-Delivery"
+	WebhookTimestampHeader = "X-Hermes-Timestamp"
+	WebhookSignatureHeader = "X-Hermes-Signature"
+)
+
+// SignWebhookPayload signs a webhook body sent at the given unix timestamp.
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature checks a signature made by SignWebhookPayload.
+func VerifyWebhookSignature(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(SignWebhookPayload(secret, timestamp, body)), []byte(signature))
+}
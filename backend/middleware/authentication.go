@@ -13,8 +13,16 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// APIKeyHeader carries a personal API key in place of a bearer token.
+const APIKeyHeader = "X-API-Key"
+
 func AuthenticationMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if apiKey := c.GetHeader(APIKeyHeader); apiKey != "" {
+			authenticateAPIKey(c, apiKey)
+			return
+		}
+
 		var authHeader string
 		authHeader = c.GetHeader("Authorization")
 
@@ -48,6 +56,12 @@ func AuthenticationMiddleware() gin.HandlerFunc {
 
 		ID, _ := primitive.ObjectIDFromHex(claims["sub"].(string))
 
+		session, ok := validateSession(c, claims, ID)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+			return
+		}
+
 		user, err := database.GetUserByID(ID)
 
 		if err != nil {
@@ -55,10 +69,144 @@ func AuthenticationMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		c.Set("user", user)
+		c.Set("userID", user.ID)
+		c.Set("role", user.Role)
+		c.Set("sessionID", session.ID)
+		if !session.Impersonator.IsZero() {
+			c.Set("impersonator", session.Impersonator)
+			c.Header("X-Impersonated-By", session.Impersonator.Hex())
+			c.Next()
+			recordImpersonatedWrite(c, session)
+			return
+		}
+		c.Next()
+
+	}
+}
+
+// WebSocketAuthenticationMiddleware authenticates a WebSocket upgrade with
+// the single use ticket in the ticket query parameter, as browsers cannot
+// set headers on WebSocket requests. Clients that can send headers are
+// authenticated as usual.
+func WebSocketAuthenticationMiddleware() gin.HandlerFunc {
+	authenticate := AuthenticationMiddleware()
+	return func(c *gin.Context) {
+		raw := c.Query("ticket")
+		if raw == "" {
+			authenticate(c)
+			return
+		}
+
+		ticket, err := database.ConsumeWebSocketTicket(raw)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired ticket"})
+			return
+		}
+		if !ticket.Session.IsZero() {
+			session, err := database.GetSessionByID(ticket.Session)
+			if err != nil || !session.IsActive() {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+				return
+			}
+			c.Set("sessionID", session.ID)
+		}
+		user, err := database.GetUserByID(ticket.User)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			return
+		}
+
 		c.Set("user", user)
 		c.Set("userID", user.ID)
 		c.Set("role", user.Role)
 		c.Next()
+	}
+}
+
+// recordImpersonatedWrite marks every state-changing request made under an
+// impersonation token in the audit log.
+func recordImpersonatedWrite(c *gin.Context, session database.Session) {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return
+	}
+	database.CreateAuditEvent(database.AuditEvent{
+		Action:  database.AuditAction.ImpersonatedWrite,
+		Actor:   session.Impersonator,
+		Subject: session.User,
+		Session: session.ID,
+		Method:  c.Request.Method,
+		Path:    c.Request.URL.RequestURI(),
+		Status:  c.Writer.Status(),
+		IP:      c.ClientIP(),
+	})
+}
+
+// authenticateAPIKey resolves a personal API key to its owner and checks the
+// key's scopes against the resource being requested.
+func authenticateAPIKey(c *gin.Context, rawKey string) {
+	key, err := database.GetAPIKeyByHash(database.HashAPIKey(rawKey))
+	if err != nil || !key.IsActive() {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		return
+	}
+
+	write := c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead
+	if !key.HasScope(apiResource(c.Request.URL.Path), write) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API key does not have the required scope"})
+		return
+	}
 
+	user, err := database.GetUserByID(key.User)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	database.TouchAPIKey(key.ID)
+
+	c.Set("user", user)
+	c.Set("userID", user.ID)
+	c.Set("role", user.Role)
+	c.Set("apiKey", key)
+	c.Next()
+}
+
+// apiResource returns the route group of a request path, "/api/courses/all"
+// gives "courses".
+func apiResource(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 2 || parts[0] != "api" {
+		return ""
+	}
+	return parts[1]
+}
+
+// sessionTouchInterval limits how often a session's last seen time is written.
+const sessionTouchInterval = time.Minute
+
+// validateSession checks the session named by the token's "sid" claim is
+// still active. Tokens issued before sessions were tracked carry no "sid" and
+// are accepted until they expire.
+func validateSession(c *gin.Context, claims jwt.MapClaims, userID primitive.ObjectID) (database.Session, bool) {
+	sid, ok := claims["sid"].(string)
+	if !ok {
+		// an impersonation token is only honoured with its session
+		_, impersonating := claims["act"]
+		return database.Session{}, !impersonating
+	}
+	sessionID, err := primitive.ObjectIDFromHex(sid)
+	if err != nil {
+		return database.Session{}, false
+	}
+
+	session, err := database.GetSessionByID(sessionID)
+	if err != nil || session.User != userID || !session.IsActive() {
+		return database.Session{}, false
+	}
+	if time.Since(session.LastSeenAt) > sessionTouchInterval {
+		database.TouchSession(session.ID, c.ClientIP())
 	}
+	return session, true
 }
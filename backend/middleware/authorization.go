@@ -23,3 +23,15 @@ func AuthorizationMiddleware(allowedRoles ...string) gin.HandlerFunc {
 		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Unauthorized user access denied"})
 	}
 }
+
+// DenyImpersonation blocks account-level changes made with an impersonation
+// token, such as changing the password or minting API keys.
+func DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("impersonator"); ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Not allowed while impersonating"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -63,6 +63,10 @@ func RequireAuth(c *gin.Context) {
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid && float64(time.Now().Unix()) < claims["exp"].(float64) {
 		var user database.User
 		ID, _ := primitive.ObjectIDFromHex(claims["sub"].(string))
+		if _, ok := validateSession(c, claims, ID); !ok {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
 		user, err := database.GetUserByID(ID)
 		if err != nil {
 			c.AbortWithStatus(http.StatusUnauthorized)
@@ -14,7 +14,7 @@ func RegisterRoutes(router *gin.Engine) {
 	router.Use(cors.New(cors.Config{
 		AllowOriginFunc:  func(origin string) bool { return true },
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With", middleware.APIKeyHeader},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 		MaxAge:           12 * 3600,
@@ -43,11 +43,36 @@ func RegisterRoutes(router *gin.Engine) {
 		userapi.PATCH("/", middleware.AuthorizationMiddleware(database.UserRole.Admin), controllers.UpdateUser)
 		userapi.DELETE("/", middleware.AuthorizationMiddleware(database.UserRole.Admin), controllers.DeleteUsers)
 		userapi.GET("/data", controllers.UserData)
+		userapi.GET("/schedule", controllers.GetEnrolled)
 
 		userapi.GET("/profilePic", controllers.GetProfilePicture)
 		userapi.POST("/profilePic", controllers.AddProfilePicture)
 
-		userapi.PATCH("/change-password", controllers.ChangeUserPassword)
+		userapi.PATCH("/change-password", middleware.DenyImpersonation(), controllers.ChangeUserPassword)
+
+		userapi.GET("/api-keys", controllers.GetAPIKeys)
+		userapi.POST("/api-keys", middleware.DenyImpersonation(), controllers.CreateAPIKey)
+		userapi.DELETE("/api-keys", middleware.DenyImpersonation(), controllers.RevokeAPIKey)
+
+		userapi.GET("/sessions", controllers.GetSessions)
+		userapi.DELETE("/sessions", middleware.DenyImpersonation(), controllers.RevokeSession)
+		userapi.DELETE("/sessions/others", middleware.DenyImpersonation(), controllers.RevokeOtherSessions)
+
+		userapi.DELETE("/impersonation", controllers.StopImpersonation)
+	}
+
+	adminapi := api.Group("/admin")
+	adminapi.Use(middleware.AuthenticationMiddleware(), middleware.AuthorizationMiddleware(database.UserRole.Admin))
+	{
+		adminapi.POST("/impersonate", controllers.StartImpersonation)
+		adminapi.GET("/audit", controllers.GetAuditLog)
+		adminapi.GET("/webhooks", controllers.GetWebhooks)
+		adminapi.POST("/webhooks", controllers.CreateWebhook)
+		adminapi.PATCH("/webhooks", controllers.UpdateWebhook)
+		adminapi.DELETE("/webhooks", controllers.DeleteWebhook)
+		adminapi.POST("/webhooks/test", controllers.TestWebhook)
+		adminapi.GET("/webhooks/deliveries", controllers.GetWebhookDeliveries)
+		adminapi.POST("/webhooks/deliveries/replay", controllers.ReplayWebhookDelivery)
 	}
 
 	authapi := api.Group("/auth")
@@ -56,6 +81,8 @@ func RegisterRoutes(router *gin.Engine) {
 		authapi.POST("/login", controllers.Login)
 		authapi.POST("/password/request-reset", controllers.RequestResetPassword)
 		authapi.POST("/password/reset", controllers.ResetPassword)
+		authapi.GET("/oidc/login", controllers.OIDCLogin)
+		authapi.GET("/oidc/callback", controllers.OIDCCallback)
 	}
 
 	tribuneapi := api.Group("/tribunes")
@@ -65,6 +92,42 @@ func RegisterRoutes(router *gin.Engine) {
 		tribuneapi.PATCH("/", middleware.AuthorizationMiddleware(database.UserRole.Admin, database.UserRole.Staff), controllers.UpdateTribune)
 		tribuneapi.GET("/", controllers.GetTribune)
 		tribuneapi.GET("/all", controllers.GetAllTribunes)
+		tribuneapi.POST("/read", controllers.MarkTribuneRead)
+		tribuneapi.GET("/messages", controllers.GetTribuneMessages)
+		tribuneapi.POST("/messages", controllers.PostTribuneMessage)
+		tribuneapi.PATCH("/messages", controllers.EditTribuneMessage)
+		tribuneapi.DELETE("/messages", controllers.DeleteTribuneMessage)
+		tribuneapi.GET("/messages/thread", controllers.GetMessageThread)
+		tribuneapi.GET("/messages/file", controllers.DownloadMessageFile)
+		tribuneapi.POST("/messages/reactions", controllers.AddMessageReaction)
+		tribuneapi.DELETE("/messages/reactions", controllers.RemoveMessageReaction)
+		tribuneapi.PATCH("/messages/answered", controllers.MarkQuestionAnswered)
+		tribuneapi.DELETE("/messages/answered", controllers.UnmarkQuestionAnswered)
+		tribuneapi.POST("/messages/report", controllers.ReportMessage)
+
+		tribuneapi.GET("/moderation/reports", controllers.GetReportQueue)
+		tribuneapi.POST("/moderation/action", controllers.ModerateMessage)
+		tribuneapi.GET("/moderation/mutes", controllers.GetTribuneMutes)
+		tribuneapi.DELETE("/moderation/mutes", controllers.UnmuteTribuneUser)
+		tribuneapi.GET("/moderation/filters", controllers.GetWordFilters)
+		tribuneapi.POST("/moderation/filters", controllers.CreateWordFilter)
+		tribuneapi.DELETE("/moderation/filters", controllers.DeleteWordFilter)
+		tribuneapi.GET("/moderation/log", controllers.GetModerationLog)
+
+		tribuneapi.POST("/polls/vote", controllers.VotePoll)
+		tribuneapi.DELETE("/polls/vote", controllers.RetractPollVote)
+		tribuneapi.GET("/polls/results", controllers.GetPollResults)
+		tribuneapi.PATCH("/polls/close", controllers.CloseVoting)
+		tribuneapi.POST("/quizzes/attempt", controllers.SubmitQuizAttempt)
+		tribuneapi.GET("/quizzes/attempt/mine", controllers.GetMyQuizAttempt)
+		tribuneapi.GET("/quizzes/attempts", controllers.GetQuizAttempts)
+		tribuneapi.GET("/gradebook", controllers.GetGradebook)
+
+		tribuneapi.POST("/assignments/submissions", controllers.SubmitAssignment)
+		tribuneapi.GET("/assignments/submissions", controllers.GetAssignmentSubmissions)
+		tribuneapi.GET("/assignments/submissions/mine", controllers.GetMySubmission)
+		tribuneapi.PATCH("/assignments/submissions/grade", controllers.GradeSubmission)
+		tribuneapi.GET("/assignments/submissions/file", controllers.DownloadSubmissionFile)
 	}
 
 	taskapi := api.Group("/tasks")
@@ -81,6 +144,7 @@ func RegisterRoutes(router *gin.Engine) {
 	lectureapi.Use(middleware.AuthenticationMiddleware())
 	{
 		lectureapi.POST("/", middleware.AuthorizationMiddleware(database.UserRole.Admin), controllers.CreateLecture)
+		lectureapi.POST("/tribune", middleware.AuthorizationMiddleware(database.UserRole.Admin), controllers.CreateLectureWithTribune)
 		lectureapi.PATCH("/", middleware.AuthorizationMiddleware(database.UserRole.Admin), controllers.UpdateLecture)
 		lectureapi.DELETE("/", middleware.AuthorizationMiddleware(database.UserRole.Admin), controllers.DeleteLecture)
 		lectureapi.GET("/all", controllers.GetAllLectures)
@@ -115,5 +179,38 @@ func RegisterRoutes(router *gin.Engine) {
 	notificationapi.Use(middleware.AuthenticationMiddleware())
 	{
 		notificationapi.GET("/", controllers.SSENotificationEndpoint)
+		notificationapi.GET("/inbox", controllers.GetNotificationInbox)
+		notificationapi.GET("/inbox/unread", controllers.GetUnreadNotificationCount)
+		notificationapi.POST("/inbox/read", controllers.MarkNotificationRead)
+		notificationapi.POST("/inbox/read-all", controllers.MarkAllNotificationsRead)
+		notificationapi.GET("/preferences", controllers.GetNotificationPreferences)
+		notificationapi.PUT("/preferences", controllers.UpdateNotificationPreferences)
+		notificationapi.GET("/deliveries", controllers.GetEmailDeliveries)
+		notificationapi.GET("/channels", controllers.GetNotificationChannels)
+		notificationapi.POST("/channels/subscribe", controllers.SubscribeToNotificationChannel)
+		notificationapi.DELETE("/channels/subscribe", controllers.UnsubscribeFromNotificationChannel)
+		notificationapi.POST("/channels", middleware.AuthorizationMiddleware(database.UserRole.Admin), controllers.CreateNotificationChannel)
+		notificationapi.PATCH("/channels", middleware.AuthorizationMiddleware(database.UserRole.Admin), controllers.UpdateNotificationChannel)
+		notificationapi.DELETE("/channels", middleware.AuthorizationMiddleware(database.UserRole.Admin), controllers.DeleteNotificationChannel)
+	}
+
+	announcementapi := api.Group("/announcements")
+	announcementapi.Use(middleware.AuthenticationMiddleware(), middleware.AuthorizationMiddleware(database.UserRole.Admin, database.UserRole.Staff))
+	{
+		announcementapi.GET("/", controllers.GetScheduledAnnouncements)
+		announcementapi.POST("/", controllers.ScheduleAnnouncement)
+		announcementapi.DELETE("/", controllers.CancelScheduledAnnouncement)
+	}
+
+	wsapi := api.Group("/ws")
+	{
+		wsapi.GET("/", middleware.WebSocketAuthenticationMiddleware(), controllers.WebSocketEndpoint)
+		wsapi.POST("/ticket", middleware.AuthenticationMiddleware(), controllers.CreateWebSocketTicket)
+	}
+
+	searchapi := api.Group("/search")
+	searchapi.Use(middleware.AuthenticationMiddleware())
+	{
+		searchapi.GET("/", controllers.Search)
 	}
 }
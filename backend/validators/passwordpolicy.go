@@ -0,0 +1,144 @@
+package validators
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type PasswordPolicy struct {
+	MinLength        int
+	RequireLetter    bool
+	RequireUpper     bool
+	RequireLower     bool
+	RequireDigit     bool
+	RequireSymbol    bool
+	DisallowUserInfo bool
+	// HistorySize is how many previous passwords cannot be reused.
+	HistorySize int
+	// BreachListDir holds a k-anonymity breached password list: one file per
+	// five character SHA-1 prefix, each line "SUFFIX:COUNT" as served by the
+	// Have I Been Pwned range API.
+	BreachListDir string
+}
+
+// LoadPasswordPolicy reads the policy from the environment. The defaults
+// match the original rule of eight characters with a letter and a digit.
+func LoadPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:        envInt("PASSWORD_MIN_LENGTH", 8),
+		RequireLetter:    envBool("PASSWORD_REQUIRE_LETTER", true),
+		RequireUpper:     envBool("PASSWORD_REQUIRE_UPPER", false),
+		RequireLower:     envBool("PASSWORD_REQUIRE_LOWER", false),
+		RequireDigit:     envBool("PASSWORD_REQUIRE_DIGIT", true),
+		RequireSymbol:    envBool("PASSWORD_REQUIRE_SYMBOL", false),
+		DisallowUserInfo: envBool("PASSWORD_DISALLOW_USER_INFO", true),
+		HistorySize:      envInt("PASSWORD_HISTORY", 5),
+		BreachListDir:    os.Getenv("BREACHED_PASSWORDS_DIR"),
+	}
+}
+
+func envInt(key string, fallback int) int {
+	if val, err := strconv.Atoi(os.Getenv(key)); err == nil && val >= 0 {
+		return val
+	}
+	return fallback
+}
+
+func envBool(key string, fallback bool) bool {
+	if val, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return val
+	}
+	return fallback
+}
+
+// Validate checks password against the policy. username and email may be
+// empty when they are not known.
+func (p PasswordPolicy) Validate(password, username, email string) error {
+	var hasLetter, hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, char := range password {
+		switch {
+		case unicode.IsLetter(char):
+			hasLetter = true
+			hasUpper = hasUpper || unicode.IsUpper(char)
+			hasLower = hasLower || unicode.IsLower(char)
+		case unicode.IsDigit(char):
+			hasDigit = true
+		case unicode.IsPunct(char) || unicode.IsSymbol(char) || unicode.IsSpace(char):
+			hasSymbol = true
+		}
+	}
+
+	switch {
+	case len([]rune(password)) < p.MinLength:
+		return fmt.Errorf("password must be at least %d characters long", p.MinLength)
+	case p.RequireLetter && !hasLetter:
+		return fmt.Errorf("password must contain a letter")
+	case p.RequireUpper && !hasUpper:
+		return fmt.Errorf("password must contain an uppercase letter")
+	case p.RequireLower && !hasLower:
+		return fmt.Errorf("password must contain a lowercase letter")
+	case p.RequireDigit && !hasDigit:
+		return fmt.Errorf("password must contain a digit")
+	case p.RequireSymbol && !hasSymbol:
+		return fmt.Errorf("password must contain a symbol")
+	}
+
+	if p.DisallowUserInfo {
+		lowered := strings.ToLower(password)
+		localPart, _, _ := strings.Cut(email, "@")
+		for _, info := range []string{username, localPart} {
+			info = strings.ToLower(info)
+			if len(info) >= 3 && strings.Contains(lowered, info) {
+				return fmt.Errorf("password must not contain your username or email")
+			}
+		}
+	}
+
+	breached, err := p.IsBreached(password)
+	if err != nil {
+		return err
+	}
+	if breached {
+		return fmt.Errorf("password has appeared in a data breach, choose another one")
+	}
+	return nil
+}
+
+// IsBreached looks the password up in the local breached password list. Only
+// the file for the first five characters of the SHA-1 hash is read.
+func (p PasswordPolicy) IsBreached(password string) (bool, error) {
+	if p.BreachListDir == "" {
+		return false, nil
+	}
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	file, err := os.Open(filepath.Join(p.BreachListDir, prefix))
+	if os.IsNotExist(err) {
+		file, err = os.Open(filepath.Join(p.BreachListDir, prefix+".txt"))
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read breached password list")
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(entry, suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
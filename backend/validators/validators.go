@@ -2,7 +2,6 @@ package validators
 
 import (
 	"regexp"
-	"unicode"
 )
 
 var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
@@ -11,20 +10,5 @@ func IsValidEmail(email string) bool {
 	return emailRegex.MatchString(email)
 }
 func IsValidPassword(password string) bool {
-	var (
-		hasLetter    bool
-		hasDigit     bool
-		isLongEnough = len(password) >= 8
-	)
-
-	for _, char := range password {
-		switch {
-		case unicode.IsLetter(char):
-			hasLetter = true
-		case unicode.IsDigit(char):
-			hasDigit = true
-		}
-	}
-
-	return hasLetter && hasDigit && isLongEnough
+	return LoadPasswordPolicy().Validate(password, "", "") == nil
 }